@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"time"
+
+	"vpn_checker/internal/checker"
+	"vpn_checker/internal/parser"
+)
+
+// cacheEntry is what -cache remembers about one config between runs.
+type cacheEntry struct {
+	Alive     bool      `json:"alive"`
+	CheckedAt time.Time `json:"checked_at"`
+	DeadSince time.Time `json:"dead_since,omitempty"` // first of the current run of dead results
+}
+
+// resultCache maps config fingerprints to their last known status (-cache).
+type resultCache map[string]cacheEntry
+
+// loadCache reads a -cache file. A missing file is an empty cache, so the
+// first run creates it.
+func loadCache(path string) (resultCache, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return resultCache{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	c := resultCache{}
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c resultCache) save(path string) error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o644)
+}
+
+// skipDead drops entries that every check for at least window has found
+// dead. Configs last seen alive, dead for a shorter time or not in the cache
+// are always kept.
+func (c resultCache) skipDead(entries []ConfigEntry, window time.Duration, now time.Time) (kept []ConfigEntry, skipped int) {
+	for _, e := range entries {
+		ce, ok := c[parser.Fingerprint(e.Config)]
+		if ok && !ce.Alive && !ce.DeadSince.IsZero() && now.Sub(ce.DeadSince) >= window {
+			skipped++
+			continue
+		}
+		kept = append(kept, e)
+	}
+	return kept, skipped
+}
+
+// update records the results of this run.
+func (c resultCache) update(results []checker.Result, now time.Time) {
+	for _, r := range results {
+		if r.Fingerprint == "" {
+			continue
+		}
+		ce := c[r.Fingerprint]
+		switch {
+		case r.Alive:
+			ce.DeadSince = time.Time{}
+		case ce.Alive || ce.DeadSince.IsZero():
+			ce.DeadSince = now
+		}
+		ce.Alive = r.Alive
+		ce.CheckedAt = now
+		c[r.Fingerprint] = ce
+	}
+}
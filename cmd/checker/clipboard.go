@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// clipboardCommands lists, per platform, the tools that print the clipboard
+// to stdout, in order of preference.
+func clipboardCommands() [][]string {
+	switch runtime.GOOS {
+	case "darwin":
+		return [][]string{{"pbpaste"}}
+	case "windows":
+		return [][]string{{"powershell.exe", "-NoProfile", "-Command", "Get-Clipboard -Raw"}}
+	}
+	var cmds [][]string
+	if os.Getenv("WAYLAND_DISPLAY") != "" {
+		cmds = append(cmds, []string{"wl-paste", "--no-newline"})
+	}
+	return append(cmds,
+		[]string{"xclip", "-selection", "clipboard", "-o"},
+		[]string{"xsel", "--clipboard", "--output"},
+		[]string{"termux-clipboard-get"},
+	)
+}
+
+// readClipboard returns the system clipboard's text using the first
+// available platform tool.
+func readClipboard() (string, error) {
+	var lastErr error
+	for _, argv := range clipboardCommands() {
+		if _, err := exec.LookPath(argv[0]); err != nil {
+			continue
+		}
+		var stderr bytes.Buffer
+		cmd := exec.Command(argv[0], argv[1:]...)
+		cmd.Stderr = &stderr
+		out, err := cmd.Output()
+		if err != nil {
+			lastErr = fmt.Errorf("%s: %v %s", argv[0], err, strings.TrimSpace(stderr.String()))
+			continue
+		}
+		return string(out), nil
+	}
+	if lastErr != nil {
+		return "", lastErr
+	}
+	return "", fmt.Errorf("no clipboard available (headless system? on Linux install wl-clipboard, xclip or xsel)")
+}
+
+// readClipboardConfigs parses configs from the clipboard, in any format
+// parseInput detects (a copied subscription blob, Clash YAML, a web page).
+func readClipboardConfigs(opts inputOptions) ([]ConfigEntry, error) {
+	text, err := readClipboard()
+	if err != nil {
+		return nil, err
+	}
+	entries, err := parseInput([]byte(text), "clipboard", opts.Extract)
+	if err != nil {
+		return nil, err
+	}
+	return selectEntries(entries, opts), nil
+}
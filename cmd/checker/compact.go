@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"golang.org/x/term"
+
+	"vpn_checker/internal/checker"
+)
+
+// compact switches printTable to the dense layout (-compact, or automatically
+// on terminals narrower than the regular table).
+var compact bool
+
+// compactColumns is the -compact layout: space-separated, fitting 80 columns.
+var compactColumns = []tableColumn{
+	{header: "#", width: 3, value: func(r checker.Result) string { return strconv.Itoa(r.Index) }},
+	{header: "NAME", width: 20, value: func(r checker.Result) string { return truncate(r.Name, 20) }},
+	{header: "PROTO", width: 6, value: func(r checker.Result) string { return truncate(r.Protocol, 6) }},
+	{header: "OK", width: 4, value: func(r checker.Result) string {
+		if r.Alive {
+			return colorGreen + "OK" + colorReset
+		}
+		return colorRed + "FAIL" + colorReset
+	}},
+	{header: "MS", width: 6, right: true, value: aliveOnly(func(r checker.Result) string {
+		return strconv.FormatInt(r.Latency.Milliseconds(), 10)
+	})},
+	{header: "CC", width: 5, value: aliveOnly(func(r checker.Result) string { return countryLabel(r.Country) })},
+	{header: "EXIT IP", value: aliveOnly(func(r checker.Result) string { return r.ExitIP })},
+}
+
+// compactErrorWidth keeps the error lines under dead rows within 80 columns.
+const compactErrorWidth = 74
+
+// tableWidth is the visible width of a row of cols joined with sep.
+func tableWidth(cols []tableColumn, sep string) int {
+	width := visibleLen(sep) * (len(cols) - 1)
+	for _, c := range cols {
+		width += c.width
+	}
+	return width
+}
+
+// narrowTerminal reports whether stdout is a terminal too narrow for the
+// regular table with the selected -columns.
+func narrowTerminal() bool {
+	fd := int(os.Stdout.Fd())
+	if !term.IsTerminal(fd) {
+		return false
+	}
+	width, _, err := term.GetSize(fd)
+	return err == nil && width < tableWidth(tableColumns, tableSep)
+}
+
+// printCompactTable is printTable's -compact layout: no separator lines, one
+// truncated error line per dead config, warnings and extra checks left out.
+func printCompactTable(results []checker.Result) {
+	cols := compactColumns
+	headers := make([]string, len(cols))
+	for i, c := range cols {
+		headers[i] = c.header
+	}
+	fmt.Printf("%s%s%s\n", boldOn, tableRow(cols, headers, " "), colorReset)
+
+	alive := 0
+	for _, r := range results {
+		cells := make([]string, len(cols))
+		for i, c := range cols {
+			cells[i] = c.value(r)
+		}
+		fmt.Println(tableRow(cols, cells, " "))
+		if r.Alive {
+			alive++
+		} else if r.Error != "" {
+			fmt.Printf("    %s%s%s\n", colorRed, truncate(r.Error, compactErrorWidth), colorReset)
+		}
+	}
+	fmt.Printf("%sTotal: %d  Alive: %d%s  Dead: %d\n",
+		boldOn, len(results), alive, colorReset, len(results)-alive)
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"vpn_checker/internal/checker"
+)
+
+// diffChange describes one config whose status differs from the previous run.
+type diffChange struct {
+	Fingerprint string `json:"fingerprint"`
+	Name        string `json:"name"`
+	Protocol    string `json:"protocol"`
+	Server      string `json:"server"`
+	Port        int    `json:"port"`
+	OldExitIP   string `json:"old_exit_ip,omitempty"`
+	NewExitIP   string `json:"new_exit_ip,omitempty"`
+	OldCountry  string `json:"old_country,omitempty"`
+	NewCountry  string `json:"new_country,omitempty"`
+	Error       string `json:"error,omitempty"`
+}
+
+// runDiff is the -diff report comparing two runs matched by fingerprint.
+type runDiff struct {
+	NewlyDead   []diffChange `json:"newly_dead"`
+	NewlyAlive  []diffChange `json:"newly_alive"`
+	ExitChanged []diffChange `json:"exit_changed"`
+}
+
+// loadPrevious reads a -json output file keyed by fingerprint.
+func loadPrevious(path string) (map[string]jsonResult, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var prev []jsonResult
+	if err := json.Unmarshal(data, &prev); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	out := make(map[string]jsonResult, len(prev))
+	for _, r := range prev {
+		key := r.Fingerprint
+		if key == "" {
+			// Older output without fingerprints — fall back to the endpoint.
+			key = fmt.Sprintf("%s|%s:%d", r.Protocol, r.Server, r.Port)
+		}
+		out[key] = r
+	}
+	return out, nil
+}
+
+// computeDiff compares the current results with the previous run.
+// Configs absent from the previous run count as newly alive if they are alive now.
+func computeDiff(prev map[string]jsonResult, results []checker.Result) runDiff {
+	d := runDiff{NewlyDead: []diffChange{}, NewlyAlive: []diffChange{}, ExitChanged: []diffChange{}}
+	for _, r := range results {
+		old, ok := prev[r.Fingerprint]
+		if !ok {
+			old, ok = prev[fmt.Sprintf("%s|%s:%d", r.Protocol, r.Server, r.Port)]
+		}
+		c := diffChange{
+			Fingerprint: r.Fingerprint,
+			Name:        r.Name,
+			Protocol:    r.Protocol,
+			Server:      r.Server,
+			Port:        r.Port,
+			OldExitIP:   old.ExitIP,
+			NewExitIP:   r.ExitIP,
+			OldCountry:  old.Country,
+			NewCountry:  r.Country,
+		}
+		switch {
+		case r.Alive && (!ok || !old.Alive):
+			d.NewlyAlive = append(d.NewlyAlive, c)
+		case !r.Alive && ok && old.Alive:
+			c.Error = r.Error
+			d.NewlyDead = append(d.NewlyDead, c)
+		case r.Alive && (old.ExitIP != r.ExitIP || old.Country != r.Country):
+			d.ExitChanged = append(d.ExitChanged, c)
+		}
+	}
+	return d
+}
+
+// aliveSetHash identifies the set of alive configs by hashing their sorted
+// fingerprints: two runs that found the same working configs print the same
+// value whatever the input order, names or latencies. "" when none is alive.
+func aliveSetHash(results []checker.Result) string {
+	var fps []string
+	for _, r := range results {
+		if r.Alive && r.Fingerprint != "" {
+			fps = append(fps, r.Fingerprint)
+		}
+	}
+	if len(fps) == 0 {
+		return ""
+	}
+	sort.Strings(fps)
+	sum := sha256.Sum256([]byte(strings.Join(fps, "\n")))
+	return hex.EncodeToString(sum[:6])
+}
+
+// reportDiff prints the diff against prevPath to stderr and optionally writes it as JSON.
+func reportDiff(prevPath, outPath string, results []checker.Result) error {
+	prev, err := loadPrevious(prevPath)
+	if err != nil {
+		return err
+	}
+	d := computeDiff(prev, results)
+
+	fmt.Fprintf(os.Stderr, "\n%sChanges since %s:%s\n", boldOn, prevPath, colorReset)
+	for _, c := range d.NewlyAlive {
+		fmt.Fprintf(os.Stderr, "  %s+ alive%s  %-30s %s:%d  %s\n",
+			colorGreen, colorReset, truncate(c.Name, 30), c.Server, c.Port, c.NewCountry)
+	}
+	for _, c := range d.NewlyDead {
+		fmt.Fprintf(os.Stderr, "  %s- dead %s  %-30s %s:%d  %s\n",
+			colorRed, colorReset, truncate(c.Name, 30), c.Server, c.Port, truncate(c.Error, 40))
+	}
+	for _, c := range d.ExitChanged {
+		fmt.Fprintf(os.Stderr, "  %s~ exit %s  %-30s %s %s → %s %s\n",
+			colorYellow, colorReset, truncate(c.Name, 30), c.OldExitIP, c.OldCountry, c.NewExitIP, c.NewCountry)
+	}
+	fmt.Fprintf(os.Stderr, "%d newly alive, %d newly dead, %d exit changed\n",
+		len(d.NewlyAlive), len(d.NewlyDead), len(d.ExitChanged))
+
+	if outPath == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(d, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(outPath, data, 0o644)
+}
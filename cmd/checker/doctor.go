@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"time"
+
+	"vpn_checker/internal/checker"
+	"vpn_checker/internal/xray"
+)
+
+// doctorCheck is one environment probe of -doctor.
+type doctorCheck struct {
+	name string
+	run  func() (string, error)
+}
+
+// runDoctor checks that the environment can check configs at all: xray runs,
+// DNS resolves, the geo API answers directly and through a local SOCKS hop.
+// It prints one line per check and reports whether all of them passed.
+func runDoctor(timeout time.Duration) bool {
+	checks := []doctorCheck{
+		{"xray", func() (string, error) {
+			return xray.Available()
+		}},
+		{"dns", func() (string, error) {
+			addrs, err := net.LookupHost("ip-api.com")
+			if err != nil {
+				return "", err
+			}
+			return "ip-api.com → " + addrs[0], nil
+		}},
+		{"geo (direct)", func() (string, error) {
+			ip, country, err := checker.LookupDirect(timeout)
+			if err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("%s %s", ip, country), nil
+		}},
+		{"socks via xray", func() (string, error) {
+			r := checker.CheckDirect(timeout)
+			if !r.Alive {
+				return "", fmt.Errorf("%s", r.Error)
+			}
+			return fmt.Sprintf("%s %s in %dms", r.ExitIP, r.Country, r.Latency.Milliseconds()), nil
+		}},
+	}
+
+	ok := true
+	for _, c := range checks {
+		detail, err := c.run()
+		if err != nil {
+			ok = false
+			fmt.Printf("%s✘%s %-16s %s%v%s\n", colorRed, colorReset, c.name, colorRed, err, colorReset)
+			continue
+		}
+		fmt.Printf("%s✔%s %-16s %s\n", colorGreen, colorReset, c.name, detail)
+	}
+	if ok {
+		fmt.Printf("\n%sEnvironment OK:%s dead configs are the configs' fault.\n", colorGreen, colorReset)
+	} else {
+		fmt.Printf("\n%sEnvironment problems found:%s fix these before blaming the config list.\n", colorRed, colorReset)
+	}
+	return ok
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+
+	"vpn_checker/internal/parser"
+)
+
+// dedupeNames makes every config name unique by suffixing the configs that
+// share one (-dup-names): "index" numbers them ("Premium #1", "Premium #2"),
+// "host" appends the server ("Premium @ de1.example.com") and numbers only
+// those still equal after that. Both the parsed config and its raw URI are
+// renamed, so the table, the web UI and exports all show the new names.
+// It returns how many configs were renamed.
+func dedupeNames(entries []ConfigEntry, mode string) int {
+	names := make([]string, len(entries))
+	for i, e := range entries {
+		names[i] = e.Config.GetName()
+	}
+	if mode == "host" {
+		for _, group := range duplicateNames(names) {
+			for _, i := range group {
+				names[i] = fmt.Sprintf("%s @ %s", names[i], entries[i].Config.GetServer())
+			}
+		}
+	}
+	for _, group := range duplicateNames(names) {
+		for n, i := range group {
+			names[i] = fmt.Sprintf("%s #%d", names[i], n+1)
+		}
+	}
+
+	renamed := 0
+	for i, e := range entries {
+		if names[i] == e.Config.GetName() {
+			continue
+		}
+		parser.SetName(e.Config, names[i])
+		if e.RawURI != "" {
+			entries[i].RawURI = parser.RenameURI(e.RawURI, names[i])
+		}
+		renamed++
+	}
+	return renamed
+}
+
+// duplicateNames returns the indices of names that occur more than once,
+// grouped by name in order of first appearance.
+func duplicateNames(names []string) [][]int {
+	byName := make(map[string][]int)
+	var order []string
+	for i, name := range names {
+		if _, seen := byName[name]; !seen {
+			order = append(order, name)
+		}
+		byName[name] = append(byName[name], i)
+	}
+	var groups [][]int
+	for _, name := range order {
+		if len(byName[name]) > 1 {
+			groups = append(groups, byName[name])
+		}
+	}
+	return groups
+}
+
+// checkDupNamesMode validates a -dup-names value.
+func checkDupNamesMode(mode string) error {
+	switch mode {
+	case "", "index", "host":
+		return nil
+	}
+	return fmt.Errorf("unknown mode %q (want index or host)", mode)
+}
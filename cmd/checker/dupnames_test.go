@@ -0,0 +1,58 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"vpn_checker/internal/parser"
+)
+
+func dupEntries(t *testing.T) []ConfigEntry {
+	t.Helper()
+	uris := []string{
+		"trojan://p@a.example.com:443#Premium",
+		"trojan://q@a.example.com:443#Premium",
+		"trojan://p@b.example.com:443#Premium",
+		"trojan://p@c.example.com:443#Other",
+	}
+	entries := make([]ConfigEntry, len(uris))
+	for i, uri := range uris {
+		cfg, err := parser.ParseLine(uri)
+		if err != nil {
+			t.Fatal(err)
+		}
+		entries[i] = ConfigEntry{RawURI: uri, Config: cfg}
+	}
+	return entries
+}
+
+func TestSelectEntriesDupNames(t *testing.T) {
+	tests := []struct {
+		mode string
+		want []string
+	}{
+		{"", []string{"Premium", "Premium", "Premium", "Other"}},
+		{"index", []string{"Premium #1", "Premium #2", "Premium #3", "Other"}},
+		{"host", []string{"Premium @ a.example.com #1", "Premium @ a.example.com #2", "Premium @ b.example.com", "Other"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			entries := selectEntries(dupEntries(t), inputOptions{DupNames: tt.mode})
+			var names, uriNames []string
+			for _, e := range entries {
+				names = append(names, e.Config.GetName())
+				cfg, err := parser.ParseLine(e.RawURI)
+				if err != nil {
+					t.Fatal(err)
+				}
+				uriNames = append(uriNames, cfg.GetName())
+			}
+			if !reflect.DeepEqual(names, tt.want) {
+				t.Errorf("names = %q, want %q", names, tt.want)
+			}
+			if !reflect.DeepEqual(uriNames, tt.want) {
+				t.Errorf("names in RawURI = %q, want %q", uriNames, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"vpn_checker/internal/checker"
+	"vpn_checker/internal/parser"
+	"vpn_checker/internal/singbox"
+	"vpn_checker/internal/xray"
+)
+
+// printNormalized writes each config in canonical URI form to stdout, skipping
+// duplicates. Configs that can't be re-serialized are passed through as-is.
+func printNormalized(entries []ConfigEntry) {
+	seen := make(map[string]struct{}, len(entries))
+	for _, e := range entries {
+		uri, err := parser.Marshal(e.Config)
+		if err != nil {
+			if e.RawURI == "" {
+				fmt.Fprintf(os.Stderr, "%sskip%s %s: %v\n", colorYellow, colorReset, e.Config.GetName(), err)
+				continue
+			}
+			uri = e.RawURI
+		}
+		if _, dup := seen[uri]; dup {
+			continue
+		}
+		seen[uri] = struct{}{}
+		fmt.Println(uri)
+	}
+}
+
+// writeSubscription saves the alive configs as a v2rayN subscription: the whole
+// file is base64 of the newline-joined URIs from exportURI.
+func writeSubscription(path string, results []checker.Result, entries []ConfigEntry) (int, error) {
+	var uris []string
+	for _, r := range results {
+		if !r.Alive || r.Index < 1 || r.Index > len(entries) {
+			continue
+		}
+		if uri := exportURI(r, entries[r.Index-1]); uri != "" {
+			uris = append(uris, uri)
+		}
+	}
+	body := base64.StdEncoding.EncodeToString([]byte(strings.Join(uris, "\n")))
+	return len(uris), os.WriteFile(path, []byte(body), 0o644)
+}
+
+// writeSplit saves the alive configs into dir as one plain URI list per exit
+// country (US.txt, DE.txt, ...); configs without a known country go to
+// unknown.txt. It returns the number of files and configs written.
+func writeSplit(dir string, results []checker.Result, entries []ConfigEntry) (files, n int, err error) {
+	byCountry := make(map[string][]string)
+	for _, r := range results {
+		if !r.Alive || r.Index < 1 || r.Index > len(entries) {
+			continue
+		}
+		if uri := exportURI(r, entries[r.Index-1]); uri != "" {
+			name := splitFileName(r.Country)
+			byCountry[name] = append(byCountry[name], uri)
+			n++
+		}
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return 0, 0, err
+	}
+	for name, uris := range byCountry {
+		body := strings.Join(uris, "\n") + "\n"
+		if err := os.WriteFile(filepath.Join(dir, name+".txt"), []byte(body), 0o644); err != nil {
+			return files, n, err
+		}
+		files++
+	}
+	return files, n, nil
+}
+
+// splitFileName is the -split-out file name for a country code: the code
+// upper-cased, or "unknown" when it is missing or not two letters.
+func splitFileName(country string) string {
+	cc := strings.ToUpper(country)
+	if len(cc) != 2 || cc[0] < 'A' || cc[0] > 'Z' || cc[1] < 'A' || cc[1] > 'Z' {
+		return "unknown"
+	}
+	return cc
+}
+
+// exportURI returns the share URI to publish for r: the raw input URI, or
+// parser.Marshal's for entries without one (Clash imports). Alive configs are
+// renamed according to -name-template when set. "" if there is no URI.
+func exportURI(r checker.Result, e ConfigEntry) string {
+	uri := e.RawURI
+	if uri == "" {
+		var err error
+		if uri, err = parser.Marshal(e.Config); err != nil {
+			return ""
+		}
+	}
+	if nameTemplate == "" || !r.Alive {
+		return uri
+	}
+	return parser.RenameURI(uri, expandNameTemplate(nameTemplate, r))
+}
+
+// expandNameTemplate fills {country}, {latency}, {proto}, {idx} and {name}.
+func expandNameTemplate(tmpl string, r checker.Result) string {
+	country := r.Country
+	if country == "" {
+		country = "??"
+	}
+	return strings.NewReplacer(
+		"{country}", country,
+		"{latency}", fmt.Sprintf("%dms", r.Latency.Milliseconds()),
+		"{proto}", r.Protocol,
+		"{idx}", strconv.Itoa(r.Index),
+		"{name}", r.Name,
+	).Replace(tmpl)
+}
+
+// writeSingbox saves the alive configs as a sing-box outbounds array. Configs
+// sing-box can't express are reported on stderr and left out.
+func writeSingbox(path string, results []checker.Result, entries []ConfigEntry) (int, error) {
+	configs := make([]parser.ProxyConfig, len(entries))
+	for i, e := range entries {
+		configs[i] = e.Config
+	}
+	data, err := singbox.Marshal(results, configs)
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, r := range results {
+		if !r.Alive || r.Index < 1 || r.Index > len(configs) {
+			continue
+		}
+		cfg := configs[r.Index-1]
+		if err := singbox.Unsupported(cfg); err != nil {
+			fmt.Fprintf(os.Stderr, "%sskip%s sing-box export %q (%s): %v\n",
+				colorYellow, colorReset, cfg.GetName(), cfg.GetProtocol(), err)
+			continue
+		}
+		n++
+	}
+	return n, os.WriteFile(path, append(data, '\n'), 0o644)
+}
+
+// Local ports of the inbounds in -emit-xray configs, the usual v2rayN defaults.
+const (
+	emitSocksPort = 10808
+	emitHTTPPort  = 10809
+)
+
+// writeXrayConfigs saves ready-to-run xray configs (-emit-xray). When path is
+// a directory (existing, or ending in a separator) every alive config is
+// written into it as <index>-<name>.json; otherwise path receives the config
+// of the fastest alive one. Returns how many files were written.
+func writeXrayConfigs(path string, results []checker.Result, entries []ConfigEntry) (int, error) {
+	var alive []checker.Result
+	for _, r := range results {
+		if r.Alive && r.Index >= 1 && r.Index <= len(entries) {
+			alive = append(alive, r)
+		}
+	}
+	if len(alive) == 0 {
+		return 0, fmt.Errorf("no alive configs")
+	}
+
+	generate := func(r checker.Result) ([]byte, error) {
+		data, err := xray.GenerateClientConfig(entries[r.Index-1].Config, emitSocksPort, emitHTTPPort)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", r.Name, err)
+		}
+		return append(data, '\n'), nil
+	}
+
+	if fi, err := os.Stat(path); (err == nil && fi.IsDir()) || strings.HasSuffix(path, string(os.PathSeparator)) {
+		if err := os.MkdirAll(path, 0o755); err != nil {
+			return 0, err
+		}
+		for i, r := range alive {
+			data, err := generate(r)
+			if err == nil {
+				name := fmt.Sprintf("%d-%s.json", r.Index, checker.SanitizeFilename(r.Name))
+				err = os.WriteFile(filepath.Join(path, name), data, 0o644)
+			}
+			if err != nil {
+				return i, err
+			}
+		}
+		return len(alive), nil
+	}
+
+	fastest := alive[0]
+	for _, r := range alive[1:] {
+		if r.Latency < fastest.Latency {
+			fastest = r
+		}
+	}
+	data, err := generate(fastest)
+	if err != nil {
+		return 0, err
+	}
+	return 1, os.WriteFile(path, data, 0o644)
+}
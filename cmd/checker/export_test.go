@@ -0,0 +1,56 @@
+package main
+
+import (
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"vpn_checker/internal/checker"
+	"vpn_checker/internal/input"
+	"vpn_checker/internal/parser"
+)
+
+func TestWriteSubscriptionDecodes(t *testing.T) {
+	uris := []string{
+		"vless://11111111-2222-3333-4444-555555555555@vless.example.com:443?type=ws&security=tls&path=%2Fws%3Fed%3D2048#%F0%9F%87%A9%F0%9F%87%AA%20DE",
+		"trojan://secret@trojan.example.com:443?sni=trojan.example.com#dead",
+		"ss://YWVzLTI1Ni1nY206cGFzc3dvcmQ@ss.example.com:8388#ss",
+		"vmess://" + base64.StdEncoding.EncodeToString([]byte(`{"v":"2","ps":"vm","add":"vmess.example.com","port":"443","id":"11111111-2222-3333-4444-555555555555","aid":"0","net":"tcp"}`)),
+	}
+	entries := make([]ConfigEntry, len(uris))
+	results := make([]checker.Result, len(uris))
+	for i, uri := range uris {
+		cfg, err := parser.ParseLine(uri)
+		if err != nil {
+			t.Fatalf("parse %s: %v", uri, err)
+		}
+		entries[i] = ConfigEntry{RawURI: uri, Config: cfg}
+		results[i] = checker.Result{Index: i + 1, Alive: i != 1}
+	}
+
+	path := filepath.Join(t.TempDir(), "sub.txt")
+	n, err := writeSubscription(path, results, entries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 3 {
+		t.Errorf("wrote %d configs, want the 3 alive ones", n)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if input.Detect(data) != input.Base64 {
+		t.Fatalf("subscription is not detected as base64: %q", data)
+	}
+	decoded, err := base64.StdEncoding.DecodeString(string(data))
+	if err != nil {
+		t.Fatalf("subscription is not standard base64: %v", err)
+	}
+	want := strings.Join([]string{uris[0], uris[2], uris[3]}, "\n")
+	if string(decoded) != want {
+		t.Errorf("decoded subscription:\n%s\nwant:\n%s", decoded, want)
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"vpn_checker/internal/checker"
+)
+
+// outputFormats maps each -format value to the function printing results in it.
+var outputFormats = map[string]func([]checker.Result){
+	"table":  printTable,
+	"json":   printJSON,
+	"csv":    printCSV,
+	"ndjson": printNDJSON,
+	"yaml":   printYAML,
+}
+
+// resolveFormat validates -format and folds the legacy -json switch into it.
+func resolveFormat(format string, jsonOut bool) (string, error) {
+	if jsonOut {
+		if format != "" && format != "json" {
+			return "", fmt.Errorf("-json conflicts with -format %s", format)
+		}
+		return "json", nil
+	}
+	if format == "" {
+		return "table", nil
+	}
+	if _, ok := outputFormats[format]; !ok {
+		return "", fmt.Errorf("unknown format %q (want %s)", format, formatNames())
+	}
+	return format, nil
+}
+
+// formatNames lists the -format values for error messages.
+func formatNames() string {
+	names := make([]string, 0, len(outputFormats))
+	for name := range outputFormats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// printNDJSON prints one JSON result per line, the same encoding as -stream-out.
+func printNDJSON(results []checker.Result) {
+	enc := json.NewEncoder(os.Stdout)
+	for _, r := range results {
+		_ = enc.Encode(toJSONResult(r))
+	}
+}
+
+// printYAML prints the JSON result schema as a YAML sequence. Multi-line
+// errors and xray logs come out as block scalars, everything else that YAML
+// would misread (yes/no, leading '@', ...) is quoted by the encoder.
+func printYAML(results []checker.Result) {
+	enc := yaml.NewEncoder(os.Stdout)
+	enc.SetIndent(2)
+	_ = enc.Encode(toJSONResults(results))
+	_ = enc.Close()
+}
+
+// csvHeader is the column row of -format csv: the flat fields of the JSON schema.
+var csvHeader = []string{
+	"index", "name", "protocol", "server", "port", "fingerprint", "alive",
+	"latency_ms", "score", "exit_ip", "country", "is_cdn", "fail_phase", "error",
+}
+
+func printCSV(results []checker.Result) {
+	w := csv.NewWriter(os.Stdout)
+	_ = w.Write(csvHeader)
+	for _, r := range results {
+		j := toJSONResult(r)
+		_ = w.Write([]string{
+			strconv.Itoa(j.Index),
+			j.Name,
+			j.Protocol,
+			j.Server,
+			strconv.Itoa(j.Port),
+			j.Fingerprint,
+			strconv.FormatBool(j.Alive),
+			strconv.FormatInt(j.LatencyMs, 10),
+			strconv.FormatFloat(j.Score, 'f', -1, 64),
+			j.ExitIP,
+			j.Country,
+			strconv.FormatBool(j.IsCDN),
+			j.FailPhase,
+			j.Error,
+		})
+	}
+	w.Flush()
+}
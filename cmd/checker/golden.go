@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"vpn_checker/internal/parser"
+	"vpn_checker/internal/xray"
+)
+
+// goldenSocksPort is the inbound port of recorded xray configs, fixed so
+// recordings don't depend on free ports.
+const goldenSocksPort = 10808
+
+// goldenRecord is one -record-golden file: a sample URI with what the parser
+// and the xray generator made of it.
+type goldenRecord struct {
+	URI    string          `json:"uri"`
+	Type   string          `json:"type"` // Go type of the parsed config
+	Parsed json.RawMessage `json:"parsed"`
+	Xray   json.RawMessage `json:"xray"`
+}
+
+// goldenFile renders the golden record of uri. The same flags that shape
+// generated configs (-default-fp, -dns, -mux, -insecure, ...) must be used
+// when recording and verifying.
+func goldenFile(uri string) ([]byte, error) {
+	cfg, err := parser.ParseLine(uri)
+	if err != nil {
+		return nil, err
+	}
+	parsed, err := json.Marshal(cfg)
+	if err != nil {
+		return nil, err
+	}
+	xrayJSON, err := xray.GenerateConfig(cfg, goldenSocksPort)
+	if err != nil {
+		return nil, fmt.Errorf("generate: %w", err)
+	}
+	rec := goldenRecord{URI: uri, Type: fmt.Sprintf("%T", cfg), Parsed: parsed, Xray: xrayJSON}
+	data, err := json.MarshalIndent(rec, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// recordGolden writes one golden file per config into dir, named
+// <protocol>-<fingerprint>.json so re-recording a list overwrites in place.
+// Configs xray can't express are reported and skipped.
+func recordGolden(dir string, entries []ConfigEntry) (int, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, e := range entries {
+		uri := e.RawURI
+		if uri == "" {
+			var err error
+			if uri, err = parser.Marshal(e.Config); err != nil {
+				continue
+			}
+		}
+		data, err := goldenFile(uri)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%sskip%s %s: %v\n", colorYellow, colorReset, e.Config.GetName(), err)
+			continue
+		}
+		name := fmt.Sprintf("%s-%s.json", e.Config.GetProtocol(), parser.Fingerprint(e.Config))
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0o644); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+// verifyGolden re-parses the URI of every golden file in dir, regenerates its
+// record and compares it with the file byte for byte. It prints each mismatch
+// with the first differing line and reports whether all files matched.
+func verifyGolden(dir string) (bool, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return false, err
+	}
+	if len(files) == 0 {
+		return false, fmt.Errorf("no golden files in %s", dir)
+	}
+	failed := 0
+	for _, file := range files {
+		want, err := os.ReadFile(file)
+		if err != nil {
+			return false, err
+		}
+		var rec goldenRecord
+		if err := json.Unmarshal(want, &rec); err != nil {
+			return false, fmt.Errorf("%s: %w", file, err)
+		}
+		got, err := goldenFile(rec.URI)
+		switch {
+		case err != nil:
+			fmt.Printf("%sFAIL%s %s: %v\n", colorRed, colorReset, filepath.Base(file), err)
+		case !bytes.Equal(got, want):
+			fmt.Printf("%sFAIL%s %s: %s\n", colorRed, colorReset, filepath.Base(file), firstDiff(want, got))
+		default:
+			continue
+		}
+		failed++
+	}
+	fmt.Printf("%d golden files, %d matched, %d changed\n", len(files), len(files)-failed, failed)
+	return failed == 0, nil
+}
+
+// firstDiff describes the first line where got differs from want.
+func firstDiff(want, got []byte) string {
+	wl := strings.Split(string(want), "\n")
+	gl := strings.Split(string(got), "\n")
+	for i := 0; i < len(wl) || i < len(gl); i++ {
+		var w, g string
+		if i < len(wl) {
+			w = wl[i]
+		}
+		if i < len(gl) {
+			g = gl[i]
+		}
+		if w != g {
+			return fmt.Sprintf("line %d: want %q, got %q", i+1, strings.TrimSpace(w), strings.TrimSpace(g))
+		}
+	}
+	return "identical lines, different bytes"
+}
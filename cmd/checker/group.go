@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"vpn_checker/internal/checker"
+)
+
+// groupBySource splits results by the Source of their entry, keeping sources
+// in first-seen order.
+func groupBySource(results []checker.Result, entries []ConfigEntry) ([]string, map[string][]checker.Result) {
+	var order []string
+	groups := make(map[string][]checker.Result)
+	for _, r := range results {
+		source := "unknown"
+		if r.Index >= 1 && r.Index <= len(entries) && entries[r.Index-1].Source != "" {
+			source = entries[r.Index-1].Source
+		}
+		if _, ok := groups[source]; !ok {
+			order = append(order, source)
+		}
+		groups[source] = append(groups[source], r)
+	}
+	return order, groups
+}
+
+// printGroupedTable prints one table per source, each headed by its alive/dead tally.
+func printGroupedTable(results []checker.Result, entries []ConfigEntry) {
+	order, groups := groupBySource(results, entries)
+	for i, source := range order {
+		group := groups[source]
+		alive := 0
+		for _, r := range group {
+			if r.Alive {
+				alive++
+			}
+		}
+		if i > 0 {
+			fmt.Println()
+		}
+		fmt.Printf("%s%s%s  %s✔ %d%s  %s✘ %d%s\n",
+			boldOn+colorCyan, source, colorReset,
+			colorGreen, alive, colorReset,
+			colorRed, len(group)-alive, colorReset)
+		printTable(group)
+	}
+}
+
+// printGroupedJSON prints results nested under their source: {"file.txt": [...]}.
+func printGroupedJSON(results []checker.Result, entries []ConfigEntry) {
+	order, groups := groupBySource(results, entries)
+	out := make(map[string][]jsonResult, len(order))
+	for _, source := range order {
+		out[source] = toJSONResults(groups[source])
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(out)
+}
@@ -2,22 +2,45 @@ package main
 
 import (
 	"bufio"
+	"bytes"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
+	"io/fs"
+	"math"
+	"math/rand"
 	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
 	"vpn_checker/internal/checker"
+	"vpn_checker/internal/clash"
+	"vpn_checker/internal/input"
 	"vpn_checker/internal/parser"
 	"vpn_checker/internal/web"
+	"vpn_checker/internal/xray"
 )
 
 // ConfigEntry pairs the original raw URI line with its parsed form.
 type ConfigEntry struct {
 	RawURI string
 	Config parser.ProxyConfig
+	Source string        // input the entry was read from (file path or "stdin")
+	Ping   time.Duration // direct TCP connect time from -preping, 0 if unmeasured/unreachable
+}
+
+// inputOptions controls which of the parsed entries readConfigs returns.
+type inputOptions struct {
+	Limit   int  // keep only the first N valid configs (0 = all)
+	Shuffle bool // randomize order before applying Limit
+	Extract bool // pull URIs out of arbitrary text instead of reading one per line
+
+	DupNames string // suffix duplicate names after selection: "index", "host" or "" (see dedupeNames)
 }
 
 var (
@@ -30,22 +53,281 @@ var (
 	boldOn      = "\033[1m"
 )
 
+// emoji prefixes country codes with their flag emoji in the table (-emoji).
+var emoji bool
+
+// nameTemplate renames alive configs on export (-name-template), see exportURI.
+var nameTemplate string
+
+// quiet suppresses the banner, progress bar and per-result lines (-quiet).
+var quiet bool
+
 func main() {
-	file := flag.String("f", "", "path to file with VPN configs (one per line); reads stdin if not set")
+	file := flag.String("f", "", "path to file with VPN configs (one per line), or a directory of .txt lists; reads stdin if not set")
 	workers := flag.Int("w", 5, "number of concurrent workers")
 	timeout := flag.Duration("t", 10*time.Second, "timeout per config check")
-	jsonOut := flag.Bool("json", false, "output results as JSON")
+	connectTimeout := flag.Duration("connect-timeout", 0, "timeout for establishing the tunnel (dial, proxy handshake, TLS); 0 = use -t")
+	geoTimeout := flag.Duration("geo-timeout", 0, "timeout for the geo API response once the tunnel is up; 0 = use -t")
+	headerTimeout := flag.Duration("header-timeout", 0, "fail a config whose server sends no response headers within this time after the request is written (shorter than -t/-geo-timeout); 0 = off")
+	geoWorkers := flag.Int("geo-workers", 0, "run geo lookups in a separate pool of this many workers fed by the -w tunnel workers (0 = each worker does both)")
+	geoRate := flag.Float64("geo-rate", 0, "with -geo-workers: max geo lookups started per second (0 = unlimited)")
+	jsonOut := flag.Bool("json", false, "output results as JSON (same as -format json)")
+	redactFlag := flag.Bool("redact", false, "mask UUIDs, passwords and keys in the printed table/JSON, -stream-out and -diff (first/last 4 chars kept) so output can be shared")
+	format := flag.String("format", "", "output format: table, json, csv, ndjson or yaml (default table)")
+	compactFlag := flag.Bool("compact", false, "dense space-separated table that fits 80 columns (default when the terminal is narrower than the regular table)")
+	emojiFlag := flag.Bool("emoji", false, "show a flag emoji next to the exit country in the table")
 	noColor := flag.Bool("no-color", false, "disable ANSI colors")
 	serveAddr := flag.String("serve", "", "serve alive configs on this address after check (e.g. :8080)")
+	apiMode := flag.Bool("api", false, "with -serve: run as a service without input, checking config lists POSTed to /api/checks (see DOCS)")
+	apiToken := flag.String("api-token", "", "with -api: bearer token required on /api/checks; needed unless -serve listens on loopback")
+	serveAll := flag.Bool("serve-all", false, "also list dead configs (with their errors) on the served page; /configs stays alive-only")
+	serveSort := flag.String("serve-sort", "", "default order of the served page and /configs: latency, name, country or protocol, optionally :desc (e.g. latency:asc)")
 	interval := flag.Duration("interval", 5*time.Minute, "how often to re-check configs for changes (0 = no auto re-check; requires -f)")
 	recheck := flag.Duration("recheck", 10*time.Minute, "how often to re-validate already-alive configs and drop dead ones (0 = disabled)")
+	limit := flag.Int("limit", 0, "check only the first N valid configs (0 = all)")
+	sample := flag.Int("sample", 0, "check a random sample of N configs and estimate the alive share of the whole list (0 = check all)")
+	extract := flag.Bool("extract", false, "find config URIs anywhere in the input (HTML pages, chat dumps) instead of expecting one per line")
+	shuffle := flag.Bool("shuffle", false, "randomize config order before applying -limit")
+	front := flag.String("front", "", "relay config URI that every checked config is dialed through")
+	diffPrev := flag.String("diff", "", "compare results against a previous -json output file and report changes")
+	diffOut := flag.String("diff-out", "", "also write the -diff report as JSON to this file")
+	dnsServers := flag.String("dns", "", "comma-separated DNS servers for xray's resolver (e.g. 1.1.1.1,8.8.8.8)")
+	mux := flag.Int("mux", 0, "enable xray mux with this concurrency for configs that don't set mux themselves (0 = off)")
+	var urls stringList
+	flag.Var(&urls, "url", "subscription URL to read configs from (plain or base64; repeatable, combined with -f, duplicates dropped)")
+	merge := flag.Bool("merge", false, "merge and deduplicate -f/-url inputs into one base64 subscription (-sub-out, or stdout) and exit without checking")
+	clipboard := flag.Bool("clipboard", false, "read configs from the system clipboard instead of -f/stdin (a copied base64 subscription is decoded)")
+	clashIn := flag.String("clash-in", "", "read configs from the proxies: list of a Clash config.yaml instead of -f")
+	quietFlag := flag.Bool("quiet", !isTerminal(os.Stderr), "no progress bar or per-result lines, only the summary and output (default when stderr is not a TTY)")
+	flag.IntVar(&repeatRuns, "repeat", 0, "load test: check every config this many times and report success rate and latency spread (0/1 = once)")
+	flag.BoolVar(&weighted, "weighted", false, "with -repeat: spread repeat×configs attempts randomly by each URI's weight= parameter (default 1) instead of evenly")
+	flag.IntVar(&sharedExitMax, "shared-exit", 3, "after the table, list exit IPs shared by more than this many alive configs (0 = off)")
+	doctor := flag.Bool("doctor", false, "check the environment (xray, DNS, geo API, local SOCKS round-trip) and exit; non-zero exit if anything is broken")
+	recordGoldenDir := flag.String("record-golden", "", "write the parsed config and generated xray JSON of every input config as golden files into this directory and exit")
+	verifyGoldenDir := flag.String("verify-golden", "", "regenerate every golden file in this directory from its URI and report the ones that changed (non-zero exit if any)")
+	dupNames := flag.String("dup-names", "", "make duplicate config names unique before checking: index (\"Name #2\") or host (\"Name @ server\", numbered if still equal)")
+	normalize := flag.Bool("normalize", false, "print configs re-serialized in canonical URI form (deduplicated) and exit without checking")
+	groupBy := flag.String("group-by", "", "group table and JSON output; supported: source")
+	preping := flag.Bool("preping", false, "TCP-ping all servers first and check the nearest ones first")
+	dumpConfigs := flag.String("dump-configs", "", "write every generated xray config to this directory as <index>-<name>.json")
+	checkIPv6 := flag.Bool("check-ipv6", false, "also probe an IPv6-only endpoint through alive configs and report IPv6 egress")
+	scoreWeights := flag.String("score-weights", "", "weights of the score components, e.g. latency=1,ipv6=0.25,success=1,jitter=0.5 (see DOCS)")
+	mmdb := flag.String("mmdb", "", "MaxMind GeoLite2 Country/City database: resolve exit countries locally, asking the tunnel only for the exit IP (no ip-api)")
+	geoFallback := flag.String("geo-fallback", "", "comma-separated geo providers tried over the same tunnel when ip-api fails or rate-limits: ipinfo, ipwho, ifconfig")
+	lenient := flag.Bool("lenient", false, "count a config alive when the tunnel answered but the geo lookup failed (exit IP/country left empty)")
+	emitXray := flag.String("emit-xray", "", "write a ready-to-run xray config (SOCKS :10808, HTTP :10809) for the fastest alive config to this file, or for every alive config into this directory (existing or ending in /)")
+	singboxOut := flag.String("singbox-out", "", "write alive configs to this file as a sing-box outbounds JSON array")
+	nameTmpl := flag.String("name-template", "", "rename alive configs in -sub-out and the web /configs, e.g. \"[{country}] {latency} {proto}\"; placeholders: {country} {latency} {proto} {idx} {name}")
+	expectRegions := flag.String("expect-regions", "", "file of \"<country codes> <fingerprint or name>\" lines; alive configs exiting elsewhere are flagged (also: region= URI parameter)")
+	cacheFile := flag.String("cache", "", "remember each config's last status in this JSON file across runs (keyed by fingerprint)")
+	cacheSkipDead := flag.Duration("cache-skip-dead", 0, "with -cache: skip configs the cache has seen consistently dead for at least this long, e.g. 24h (alive ones are always re-checked)")
+	splitOut := flag.String("split-out", "", "write alive configs into this directory as one URI list per exit country (US.txt, DE.txt, unknown.txt)")
+	subOut := flag.String("sub-out", "", "write alive configs to this file as a base64 v2rayN subscription")
+	streamOut := flag.String("stream-out", "", "append each result to this file as a JSON line (NDJSON) as soon as it completes")
+	validateConfigs := flag.Bool("validate-configs", false, "test each generated config with 'xray run -test' before connecting; rejected configs fail with xray's error")
+	xrayAPI := flag.String("xray-api", "", "use the API of an already running xray at this address (e.g. 127.0.0.1:10085) instead of spawning one per config")
+	tun := flag.Bool("tun", false, "route checks through an xray tun inbound instead of SOCKS (Linux, needs root)")
+	overrideSNI := flag.String("override-sni", "", "use this SNI in every tls/reality config instead of the URI's (test which SNI values pass the network's filtering)")
+	insecure := flag.Bool("insecure", false, "disable TLS certificate verification for every config (debugging: tells cert problems from connection problems)")
+	defaultFp := flag.String("default-fp", "", "uTLS fingerprint for reality configs without fp, e.g. chrome (default: leave unset)")
+	portRange := flag.String("port-range", "", "allocate local SOCKS ports for xray only from this range, e.g. 20000-21000 (default: OS ephemeral range)")
+	autoWorkers := flag.Int("auto-workers", 0, "adapt concurrency between 1 and this many workers, starting from -w, based on alive latency and load average (0 = fixed -w)")
+	maxXray := flag.Int("max-xray", 0, "maximum xray processes running at once, independent of -w (0 = one per worker)")
+	listenAddr := flag.String("listen-addr", "127.0.0.1", "address the xray SOCKS inbound binds to and the checker dials")
+	xrayLogLevel := flag.String("xray-loglevel", "none", "xray log level: none, error, warning, info, debug; above none, xray output is attached to failed results")
+	columns := flag.String("columns", "", "comma-separated table columns in display order (idx,name,proto,server,status,latency,score,ip,cdn,country); default all")
+	vmessStrict := flag.Bool("vmess-strict", false, "fail vmess configs with alterId > 0 (legacy protocol) instead of trying them as AEAD with a warning")
+	stopAfterAlive := flag.Int("stop-after-alive", 0, "stop once this many alive configs are found: pending checks are skipped and in-flight ones cancelled (0 = check everything)")
+	warmup := flag.Bool("warmup", false, "send one throwaway request through each tunnel before the measured geo request, so latency is warm (no connection setup)")
+	keepAlive := flag.Duration("keepalive", 0, "after the geo lookup, hold the tunnel open this long and probe again; configs that drop in between are dead (0 = off)")
+	speedTest := flag.Bool("speedtest", false, "measure download throughput through each alive config (download_mbps)")
+	speedTestUpload := flag.Bool("speedtest-upload", false, "with -speedtest: also measure upload throughput by POSTing 5 MB (upload_mbps)")
+	speedTestURL := flag.String("speedtest-url", checker.SpeedDownloadURL, "download endpoint of -speedtest")
+	speedTestUploadURL := flag.String("speedtest-upload-url", checker.SpeedUploadURL, "endpoint accepting the -speedtest-upload POST")
+	checks := flag.String("checks", "", "comma-separated extra URLs/hosts to probe through each alive config (e.g. google.com,speed.cloudflare.com)")
 	flag.Parse()
 
+	inOpts := inputOptions{Limit: *limit, Shuffle: *shuffle, Extract: *extract, DupNames: *dupNames}
+
 	if *noColor {
 		disableColors()
 	}
+	quiet = *quietFlag
+	nameTemplate = *nameTmpl
+	if *columns != "" {
+		cols, err := parseColumns(*columns)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: -columns: %v\n", err)
+			os.Exit(1)
+		}
+		tableColumns = cols
+	}
+	emoji = *emojiFlag
+	redact = *redactFlag
+	compact = *compactFlag || narrowTerminal()
+
+	outFormat, err := resolveFormat(*format, *jsonOut)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: -format: %v\n", err)
+		os.Exit(1)
+	}
+	if err := checkDupNamesMode(*dupNames); err != nil {
+		fmt.Fprintf(os.Stderr, "error: -dup-names: %v\n", err)
+		os.Exit(1)
+	}
+	if *groupBy == "source" && outFormat != "table" && outFormat != "json" {
+		fmt.Fprintf(os.Stderr, "error: -group-by source supports only the table and json formats\n")
+		os.Exit(1)
+	}
+
+	if *groupBy != "" && *groupBy != "source" {
+		fmt.Fprintf(os.Stderr, "error: unsupported -group-by %q (supported: source)\n", *groupBy)
+		os.Exit(1)
+	}
+
+	if *front != "" {
+		cfg, err := parser.ParseLine(*front)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error parsing -front: %v\n", err)
+			os.Exit(1)
+		}
+		xray.Front = cfg
+		fmt.Fprintf(os.Stderr, "%snote:%s dialing all configs through front %s (%s:%d)\n",
+			colorYellow, colorReset, cfg.GetProtocol(), cfg.GetServer(), cfg.GetPort())
+	}
+
+	if *overrideSNI != "" {
+		xray.OverrideSNI = *overrideSNI
+		fmt.Fprintf(os.Stderr, "%snote:%s SNI overridden to %q for every tls/reality config\n",
+			colorYellow, colorReset, *overrideSNI)
+	}
+
+	if !validLogLevel(*xrayLogLevel) {
+		fmt.Fprintf(os.Stderr, "error: unsupported -xray-loglevel %q (supported: %s)\n",
+			*xrayLogLevel, strings.Join(xray.LogLevels, ", "))
+		os.Exit(1)
+	}
+
+	for _, name := range splitList(*geoFallback) {
+		if !contains(checker.GeoProviders(), name) {
+			fmt.Fprintf(os.Stderr, "error: unsupported -geo-fallback provider %q (supported: %s)\n",
+				name, strings.Join(checker.GeoProviders(), ", "))
+			os.Exit(1)
+		}
+	}
 
-	entries, err := readConfigs(*file)
+	if *mmdb != "" {
+		if err := checker.LoadGeoDB(*mmdb); err != nil {
+			fmt.Fprintf(os.Stderr, "error: -mmdb: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	weights, err := checker.ParseScoreWeights(*scoreWeights, checker.Weights)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: -score-weights: %v\n", err)
+		os.Exit(1)
+	}
+	checker.Weights = weights
+
+	checker.PortRangeMin, checker.PortRangeMax, err = checker.ParsePortRange(*portRange)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: -port-range: %v\n", err)
+		os.Exit(1)
+	}
+
+	if *tun {
+		if err := checker.TunSupported(); err != nil {
+			fmt.Fprintf(os.Stderr, "error: -tun: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	xray.LogLevel = *xrayLogLevel
+	xray.ListenAddr = *listenAddr
+	xray.DefaultFingerprint = *defaultFp
+	xray.Insecure = *insecure
+	xray.DNSServers = splitList(*dnsServers)
+	xray.MuxConcurrency = *mux
+	checker.ConnectTimeout = *connectTimeout
+	checker.GeoTimeout = *geoTimeout
+	checker.HeaderTimeout = *headerTimeout
+	checker.GeoWorkers = *geoWorkers
+	checker.GeoRate = *geoRate
+	checker.MaxXray = *maxXray
+	checker.AutoWorkersMax = *autoWorkers
+	checker.TunMode = *tun
+	if repeatRuns > 1 && *geoWorkers > 0 {
+		fmt.Fprintln(os.Stderr, "error: -repeat can't be combined with -geo-workers")
+		os.Exit(1)
+	}
+	if *xrayAPI != "" {
+		checker.Runner = &xray.APIRunner{Addr: *xrayAPI}
+	}
+	checker.ValidateConfigs = *validateConfigs
+	checker.Lenient = *lenient
+	checker.GeoFallback = splitList(*geoFallback)
+	checker.CheckIPv6 = *checkIPv6
+	checker.ExtraTargets = splitList(*checks)
+	checker.KeepAliveDelay = *keepAlive
+	checker.Warmup = *warmup
+	if *speedTestUpload && !*speedTest {
+		fmt.Fprintln(os.Stderr, "error: -speedtest-upload needs -speedtest")
+		os.Exit(1)
+	}
+	checker.SpeedTest = *speedTest
+	checker.SpeedTestUpload = *speedTestUpload
+	checker.SpeedDownloadURL = *speedTestURL
+	checker.SpeedUploadURL = *speedTestUploadURL
+	checker.StopAfterAlive = *stopAfterAlive
+	checker.VmessStrict = *vmessStrict
+	checker.DumpDir = *dumpConfigs
+
+	if *doctor {
+		if !runDoctor(*timeout) {
+			os.Exit(1)
+		}
+		return
+	}
+
+	if *verifyGoldenDir != "" {
+		ok, err := verifyGolden(*verifyGoldenDir)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: -verify-golden: %v\n", err)
+			os.Exit(1)
+		}
+		if !ok {
+			os.Exit(1)
+		}
+		return
+	}
+
+	if *apiMode {
+		if *serveAddr == "" {
+			fmt.Fprintln(os.Stderr, "error: -api needs -serve")
+			os.Exit(1)
+		}
+		if flag.NArg() > 0 || *file != "" || len(urls) > 0 || *clipboard || *clashIn != "" {
+			fmt.Fprintln(os.Stderr, "error: -api takes its configs over HTTP, not from -f/-url/-clipboard/-clash-in or arguments")
+			os.Exit(1)
+		}
+		runAPI(*serveAddr, *serveAll, *workers, *timeout, *apiToken)
+		return
+	}
+
+	var entries []ConfigEntry
+	switch {
+	case flag.NArg() > 0:
+		entries, err = readArgs(flag.Args(), inOpts)
+	case *clashIn != "":
+		entries, err = readClash(*clashIn, inOpts)
+	case *clipboard:
+		entries, err = readClipboardConfigs(inOpts)
+	case len(urls) > 0:
+		entries, err = readSources(*file, urls, inOpts)
+	default:
+		entries, err = readConfigs(*file, inOpts)
+	}
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "error reading configs: %v\n", err)
 		os.Exit(1)
@@ -55,8 +337,92 @@ func main() {
 		os.Exit(1)
 	}
 
+	if *normalize {
+		printNormalized(entries)
+		return
+	}
+
+	if *recordGoldenDir != "" {
+		n, err := recordGolden(*recordGoldenDir, entries)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error writing -record-golden: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Fprintf(os.Stderr, "%srecorded %d golden files in %s%s\n", colorGray, n, *recordGoldenDir, colorReset)
+		return
+	}
+
+	if *merge {
+		n, err := writeMerged(*subOut, entries)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error writing merged subscription: %v\n", err)
+			os.Exit(1)
+		}
+		if *subOut != "" {
+			fmt.Fprintf(os.Stderr, "%smerged %d configs into %s%s\n", colorGray, n, *subOut, colorReset)
+		}
+		return
+	}
+
+	if *expectRegions != "" {
+		regionExpectations, err = loadRegionExpectations(*expectRegions)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error reading -expect-regions: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	var cache resultCache
+	if *cacheFile != "" {
+		cache, err = loadCache(*cacheFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error reading -cache: %v\n", err)
+			os.Exit(1)
+		}
+		if *cacheSkipDead > 0 {
+			var skipped int
+			entries, skipped = cache.skipDead(entries, *cacheSkipDead, time.Now())
+			if skipped > 0 {
+				fmt.Fprintf(os.Stderr, "%sskipped %d configs the cache has seen dead for %s or longer%s\n",
+					colorGray, skipped, *cacheSkipDead, colorReset)
+			}
+			if len(entries) == 0 {
+				fmt.Fprintln(os.Stderr, "no configs left to check after -cache-skip-dead")
+				os.Exit(0)
+			}
+		}
+	}
+
+	population := len(entries)
+	if *sample > 0 && population > *sample {
+		entries = sampleEntries(entries, *sample)
+	} else {
+		population = 0
+	}
+
+	if *streamOut != "" {
+		stream, err = openResultStream(*streamOut)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error opening -stream-out: %v\n", err)
+			os.Exit(1)
+		}
+		defer stream.Close()
+	}
+
+	if *preping {
+		entries = prePing(entries, *workers*4)
+	}
+
 	// Create the web server immediately — it will serve live progress via SSE.
 	srv := web.NewServer(nil)
+	srv.SetShowDead(*serveAll)
+	if *serveSort != "" {
+		key, order, _ := strings.Cut(*serveSort, ":")
+		if err := srv.SetDefaultSort(key, order); err != nil {
+			fmt.Fprintf(os.Stderr, "error: -serve-sort: %v\n", err)
+			os.Exit(1)
+		}
+	}
 
 	if *serveAddr != "" {
 		fmt.Fprintf(os.Stderr, "\n%sServing live results:%s\n  http://localhost%s/\n  http://localhost%s/configs\n\n",
@@ -71,10 +437,77 @@ func main() {
 
 	results := runCheck(entries, *workers, *timeout, srv)
 
-	if *jsonOut {
-		printJSON(results)
-	} else {
-		printTable(results)
+	shown := redactResults(results, entries)
+	switch {
+	case *groupBy == "source" && outFormat == "json":
+		printGroupedJSON(shown, entries)
+	case *groupBy == "source":
+		printGroupedTable(shown, entries)
+	default:
+		outputFormats[outFormat](shown)
+	}
+	if outFormat == "table" && !quiet {
+		printExtremes(shown)
+		printProtocolStats(shown)
+		printFailPhases(shown)
+		printRegionMismatches(shown)
+		printSharedExits(shown)
+		printRepeatStats(shown)
+	}
+
+	if population > 0 {
+		printSampleEstimate(results, population)
+	}
+
+	if *subOut != "" {
+		n, err := writeSubscription(*subOut, results, entries)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error writing -sub-out: %v\n", err)
+		} else {
+			fmt.Fprintf(os.Stderr, "%swrote %d alive configs to %s%s\n", colorGray, n, *subOut, colorReset)
+		}
+	}
+
+	if *splitOut != "" {
+		files, n, err := writeSplit(*splitOut, results, entries)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error writing -split-out: %v\n", err)
+		} else {
+			fmt.Fprintf(os.Stderr, "%swrote %d alive configs into %d country files in %s%s\n",
+				colorGray, n, files, *splitOut, colorReset)
+		}
+	}
+
+	if *emitXray != "" {
+		n, err := writeXrayConfigs(*emitXray, results, entries)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error writing -emit-xray: %v\n", err)
+		} else {
+			fmt.Fprintf(os.Stderr, "%swrote %d xray configs to %s (socks :%d, http :%d)%s\n",
+				colorGray, n, *emitXray, emitSocksPort, emitHTTPPort, colorReset)
+		}
+	}
+
+	if *singboxOut != "" {
+		n, err := writeSingbox(*singboxOut, results, entries)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error writing -singbox-out: %v\n", err)
+		} else {
+			fmt.Fprintf(os.Stderr, "%swrote %d sing-box outbounds to %s%s\n", colorGray, n, *singboxOut, colorReset)
+		}
+	}
+
+	if cache != nil {
+		cache.update(results, time.Now())
+		if err := cache.save(*cacheFile); err != nil {
+			fmt.Fprintf(os.Stderr, "error writing -cache: %v\n", err)
+		}
+	}
+
+	if *diffPrev != "" {
+		if err := reportDiff(*diffPrev, *diffOut, shown); err != nil {
+			fmt.Fprintf(os.Stderr, "diff: %v\n", err)
+		}
 	}
 
 	if *serveAddr == "" {
@@ -83,7 +516,7 @@ func main() {
 
 	// Launch background watcher if -interval > 0 and a file path was given.
 	if *interval > 0 && *file != "" {
-		go watchAndRecheck(*file, *workers, *timeout, *interval, srv)
+		go watchAndRecheck(*file, inOpts, *workers, *timeout, *interval, srv)
 	} else if *interval > 0 && *file == "" {
 		fmt.Fprintln(os.Stderr, "note: -interval ignored when reading from stdin")
 	}
@@ -99,7 +532,7 @@ func main() {
 
 // watchAndRecheck polls the file every interval. When the file's mtime changes
 // it re-reads configs, runs a fresh check, and updates the web server.
-func watchAndRecheck(filePath string, workers int, timeout, interval time.Duration, srv *web.Server) {
+func watchAndRecheck(filePath string, inOpts inputOptions, workers int, timeout, interval time.Duration, srv *web.Server) {
 	lastMtime := fileMtime(filePath)
 
 	for {
@@ -134,7 +567,7 @@ func watchAndRecheck(filePath string, workers int, timeout, interval time.Durati
 		fmt.Fprintf(os.Stderr, "\n%s[watcher]%s %s — file changed, re-checking configs…\n",
 			colorCyan, colorReset, time.Now().Format("15:04:05"))
 
-		entries, err := readConfigs(filePath)
+		entries, err := readConfigs(filePath, inOpts)
 		if err != nil || len(entries) == 0 {
 			fmt.Fprintf(os.Stderr, "%s[watcher]%s error reading configs: %v\n", colorRed, colorReset, err)
 			continue
@@ -159,7 +592,7 @@ func recheckLoop(timeout, interval time.Duration, srv *web.Server) {
 	pos := 0
 
 	for {
-		entries := srv.Entries()
+		entries := aliveServed(srv)
 		if len(entries) == 0 {
 			time.Sleep(30 * time.Second)
 			pos = 0
@@ -169,7 +602,7 @@ func recheckLoop(timeout, interval time.Duration, srv *web.Server) {
 		// Wrap around when we've reached the end.
 		if pos >= len(entries) {
 			pos = 0
-			entries = srv.Entries()
+			entries = aliveServed(srv)
 			if len(entries) == 0 {
 				time.Sleep(30 * time.Second)
 				continue
@@ -183,16 +616,18 @@ func recheckLoop(timeout, interval time.Duration, srv *web.Server) {
 		cfg, err := parser.ParseLine(e.RawURI)
 		if err != nil {
 			// Can't parse — treat as dead and remove.
-			srv.RemoveEntry(aliveEntryKey(e))
+			srv.RemoveEntry(web.EntryKey(e))
 			continue
 		}
 
 		r := checker.CheckConfig(0, cfg, timeout)
-		key := aliveEntryKey(e)
+		key := web.EntryKey(e)
 
 		if r.Alive {
 			fmt.Fprintf(os.Stderr, "%s[recheck]%s ✔  %s — still alive (%dms)\n",
 				colorGreen, colorReset, truncate(e.Result.Name, 35), r.Latency.Milliseconds())
+			r.Index, r.Name = e.Result.Index, e.Result.Name
+			srv.RefreshEntry(web.AliveEntry{Result: r, RawURI: e.RawURI})
 		} else {
 			fmt.Fprintf(os.Stderr, "%s[recheck]%s ✘  %s — dead, removing (%s)\n",
 				colorRed, colorReset, truncate(e.Result.Name, 35), truncate(r.Error, 40))
@@ -208,13 +643,57 @@ func recheckLoop(timeout, interval time.Duration, srv *web.Server) {
 	}
 }
 
-// fileMtime returns the modification time of a file, or zero on error.
+// aliveServed returns the served entries that are alive; dead ones listed by
+// -serve-all are not re-validated.
+func aliveServed(srv *web.Server) []web.AliveEntry {
+	var out []web.AliveEntry
+	for _, e := range srv.Entries() {
+		if e.Result.Alive {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+// entryPriorities reads the prio= parameter of each entry's URI (default 0,
+// higher is checked first), or returns nil when no entry sets one.
+func entryPriorities(entries []ConfigEntry) []int {
+	var prios []int
+	for i, e := range entries {
+		p, err := strconv.Atoi(uriParam(e.RawURI, "prio"))
+		if err != nil || p == 0 {
+			continue
+		}
+		if prios == nil {
+			prios = make([]int, len(entries))
+		}
+		prios[i] = p
+	}
+	return prios
+}
+
+// fileMtime returns the modification time of a file, or zero on error. For a
+// directory it is the newest mtime of the directory itself and anything in it,
+// so edits to any list file are noticed.
 func fileMtime(path string) time.Time {
 	fi, err := os.Stat(path)
 	if err != nil {
 		return time.Time{}
 	}
-	return fi.ModTime()
+	if !fi.IsDir() {
+		return fi.ModTime()
+	}
+	newest := fi.ModTime()
+	_ = filepath.WalkDir(path, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if info, err := d.Info(); err == nil && info.ModTime().After(newest) {
+			newest = info.ModTime()
+		}
+		return nil
+	})
+	return newest
 }
 
 // runCheck runs the full check pipeline and prints progress + summary to stderr.
@@ -224,11 +703,22 @@ func runCheck(entries []ConfigEntry, workers int, timeout time.Duration, srv *we
 	for i, e := range entries {
 		configs[i] = e.Config
 	}
+	checker.Priorities = entryPriorities(entries)
+	checker.Repeats = repeatCounts(entries)
 
 	total := len(entries)
-	fmt.Fprintf(os.Stderr, "%s%sVPN Checker%s — %d configs, %d workers, timeout %s\n%s\n",
-		boldOn, colorCyan, colorReset, total, workers, timeout,
-		strings.Repeat("─", 80))
+	if !quiet {
+		workersLabel := strconv.Itoa(workers)
+		if checker.AutoWorkersMax > 0 && checker.GeoWorkers == 0 {
+			workersLabel = fmt.Sprintf("auto %d→%d", workers, checker.AutoWorkersMax)
+		}
+		fmt.Fprintf(os.Stderr, "%s%sVPN Checker%s — %d configs, %s workers, timeout %s\n%s\n",
+			boldOn, colorCyan, colorReset, total, workersLabel, timeout,
+			strings.Repeat("─", 80))
+		if xray.Insecure {
+			fmt.Fprintf(os.Stderr, "%s⚠ TLS certificate verification is DISABLED (-insecure)%s\n", colorYellow, colorReset)
+		}
+	}
 
 	if srv != nil {
 		srv.SetChecking(total)
@@ -237,11 +727,30 @@ func runCheck(entries []ConfigEntry, workers int, timeout time.Duration, srv *we
 	startAll := time.Now()
 	alive := 0
 
+	eta := newETAEstimator(startAll)
 	onResult := func(r checker.Result, done, total int) {
+		markRegion(&r, entries)
+		markPing(&r, entries)
+		if r.Alive {
+			alive++
+		}
+		if stream != nil {
+			stream.Write(redactFor(r, entries))
+		}
+		if srv != nil {
+			rawURI := ""
+			if r.Index >= 1 && r.Index <= len(entries) {
+				rawURI = exportURI(r, entries[r.Index-1])
+			}
+			srv.PublishResult(web.AliveEntry{Result: r, RawURI: rawURI}, done, total)
+		}
+		if quiet {
+			return
+		}
+
 		fmt.Fprintf(os.Stderr, "\r\033[K")
 
 		if r.Alive {
-			alive++
 			fmt.Fprintf(os.Stderr, "%s[%3d/%-3d]%s %s✔%s  %-30s %s%-12s%s %s%dms%s  %s → %s%s\n",
 				colorGray, done, total, colorReset,
 				colorGreen, colorReset,
@@ -266,35 +775,42 @@ func runCheck(entries []ConfigEntry, workers int, timeout time.Duration, srv *we
 			barW := 40
 			filled := int(pct * float64(barW))
 			bar := strings.Repeat("█", filled) + strings.Repeat("░", barW-filled)
-			fmt.Fprintf(os.Stderr, "%s[%s] %3.0f%%  %d/%d done%s",
-				colorCyan, bar, pct*100, done, total, colorReset)
-		}
-
-		if srv != nil {
-			rawURI := ""
-			if r.Index >= 1 && r.Index <= len(entries) {
-				rawURI = entries[r.Index-1].RawURI
-			}
-			srv.PublishResult(web.AliveEntry{Result: r, RawURI: rawURI}, done, total)
+			fmt.Fprintf(os.Stderr, "%s[%s] %3.0f%%  %d/%d done  ETA %s%s",
+				colorCyan, bar, pct*100, done, total, formatETA(eta.update(done, total)), colorReset)
 		}
 	}
 
-	fmt.Fprintf(os.Stderr, "%s[%s] %3d%%  0/%d done%s",
-		colorCyan, strings.Repeat("░", 40), 0, total, colorReset)
+	if !quiet {
+		fmt.Fprintf(os.Stderr, "%s[%s] %3d%%  0/%d done%s",
+			colorCyan, strings.Repeat("░", 40), 0, total, colorReset)
+	}
 
 	results := checker.CheckAll(configs, workers, timeout, onResult)
-
-	fmt.Fprintf(os.Stderr, "\r\033[K")
+	for i := range results {
+		markRegion(&results[i], entries)
+		markPing(&results[i], entries)
+	}
 
 	elapsed := time.Since(startAll)
-	dead := total - alive
-	fmt.Fprintf(os.Stderr, "%s\n", strings.Repeat("─", 80))
-	fmt.Fprintf(os.Stderr, "%s%sDone in %s%s  Total: %d  %s✔ Alive: %d%s  %s✘ Dead: %d%s\n\n",
+	dead := len(results) - alive
+	if !quiet {
+		fmt.Fprintf(os.Stderr, "\r\033[K")
+		fmt.Fprintf(os.Stderr, "%s\n", strings.Repeat("─", 80))
+	}
+	if len(results) < total {
+		fmt.Fprintf(os.Stderr, "%sStopped after %d alive (-stop-after-alive): %d of %d configs not checked%s\n",
+			colorYellow, alive, total-len(results), total, colorReset)
+	}
+	fmt.Fprintf(os.Stderr, "%s%sDone in %s%s  Total: %d  %s✔ Alive: %d%s  %s✘ Dead: %d%s\n",
 		boldOn, colorCyan, elapsed.Round(time.Millisecond), colorReset,
-		total,
+		len(results),
 		colorGreen, alive, colorReset,
 		colorRed, dead, colorReset,
 	)
+	if h := aliveSetHash(results); h != "" {
+		fmt.Fprintf(os.Stderr, "%sAlive set: %s%s\n", colorGray, h, colorReset)
+	}
+	fmt.Fprintln(os.Stderr)
 
 	if srv != nil {
 		srv.SetDone()
@@ -303,30 +819,343 @@ func runCheck(entries []ConfigEntry, workers int, timeout time.Duration, srv *we
 	return results
 }
 
-func readConfigs(filePath string) ([]ConfigEntry, error) {
-	var src *os.File
-	if filePath != "" {
-		f, err := os.Open(filePath)
+// runAPI serves the dashboard together with the /api/checks control API and
+// blocks; checks are started by POSTing config lists instead of from input.
+// They use the check flags this process was started with.
+func runAPI(addr string, showDead bool, workers int, timeout time.Duration, token string) {
+	srv := web.NewServer(nil)
+	srv.SetShowDead(showDead)
+	srv.EnableAPI(workers, timeout, token)
+	fmt.Fprintf(os.Stderr, "%sServing control API:%s\n  http://localhost%s/api/checks\n  http://localhost%s/\n\n",
+		colorCyan, colorReset, addr, addr)
+	if err := srv.Serve(addr); err != nil {
+		fmt.Fprintf(os.Stderr, "server error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// etaEstimator predicts the remaining run time from the gaps between finished
+// checks. Dead configs finish at roughly the full timeout and alive ones much
+// sooner, so single gaps jump around; an exponential moving average seeded
+// with the plain elapsed/done rate keeps the displayed ETA steady.
+type etaEstimator struct {
+	last    time.Time
+	perItem float64 // smoothed seconds per finished config
+}
+
+// etaSmoothing is the weight of the newest gap in the moving average.
+const etaSmoothing = 0.1
+
+func newETAEstimator(start time.Time) *etaEstimator {
+	return &etaEstimator{last: start}
+}
+
+// update records that done of total checks have finished and returns the
+// estimated time left.
+func (e *etaEstimator) update(done, total int) time.Duration {
+	now := time.Now()
+	gap := now.Sub(e.last).Seconds()
+	e.last = now
+	if e.perItem == 0 {
+		e.perItem = gap
+	} else {
+		e.perItem = etaSmoothing*gap + (1-etaSmoothing)*e.perItem
+	}
+	return time.Duration(e.perItem * float64(total-done) * float64(time.Second))
+}
+
+// formatETA renders d rounded to seconds, e.g. "1m23s".
+func formatETA(d time.Duration) string {
+	if d < time.Second {
+		return "<1s"
+	}
+	return d.Round(time.Second).String()
+}
+
+// prePingTimeout bounds each TCP connect of the -preping pass.
+const prePingTimeout = 3 * time.Second
+
+// prePing TCP-pings every entry and returns the entries sorted by ping
+// (unreachable last, original order otherwise kept) with Ping filled in.
+func prePing(entries []ConfigEntry, workers int) []ConfigEntry {
+	configs := make([]parser.ProxyConfig, len(entries))
+	for i, e := range entries {
+		configs[i] = e.Config
+	}
+	if !quiet {
+		fmt.Fprintf(os.Stderr, "%spre-ping:%s TCP-pinging %d servers…\n", colorCyan, colorReset, len(configs))
+	}
+	pings := checker.PingAll(configs, workers, prePingTimeout)
+
+	order := make([]int, len(entries))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		pa, pb := pings[order[a]], pings[order[b]]
+		if pa == 0 || pb == 0 {
+			return pa != 0 && pb == 0
+		}
+		return pa < pb
+	})
+
+	sorted := make([]ConfigEntry, len(entries))
+	for i, idx := range order {
+		sorted[i] = entries[idx]
+		sorted[i].Ping = pings[idx]
+	}
+	return sorted
+}
+
+// markPing copies the -preping TCP ping of r's entry into r. Results are
+// matched by Index, not position: CheckAll leaves out configs it skipped.
+func markPing(r *checker.Result, entries []ConfigEntry) {
+	if r.Index >= 1 && r.Index <= len(entries) {
+		r.TCPPing = entries[r.Index-1].Ping
+	}
+}
+
+// readArgs parses config URIs given as positional arguments, for a quick
+// check without a file. Unlike list input, an argument that fails to parse is
+// an error: it was typed on purpose.
+func readArgs(args []string, opts inputOptions) ([]ConfigEntry, error) {
+	entries := make([]ConfigEntry, 0, len(args))
+	for _, arg := range args {
+		uri := strings.TrimSpace(arg)
+		cfg, err := parser.ParseLine(uri)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", truncate(uri, 40), err)
+		}
+		entries = append(entries, ConfigEntry{RawURI: uri, Config: cfg, Source: "args"})
+	}
+	return selectEntries(entries, opts), nil
+}
+
+// readConfigs parses configs from filePath (or stdin) and applies the
+// shuffle/limit selection from opts. The input format is detected (see parseInput).
+func readConfigs(filePath string, opts inputOptions) ([]ConfigEntry, error) {
+	if filePath == "" {
+		data, err := io.ReadAll(os.Stdin)
 		if err != nil {
 			return nil, err
 		}
-		defer f.Close()
-		src = f
-	} else {
-		src = os.Stdin
+		entries, err := parseInput(data, "stdin", opts.Extract)
+		if err != nil {
+			return nil, err
+		}
+		return selectEntries(entries, opts), nil
 	}
 
+	fi, err := os.Stat(filePath)
+	if err != nil {
+		return nil, err
+	}
+	if fi.IsDir() {
+		entries, err := readConfigDir(filePath, opts.Extract)
+		if err != nil {
+			return nil, err
+		}
+		return selectEntries(entries, opts), nil
+	}
+
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := parseInput(data, filePath, opts.Extract)
+	if err != nil {
+		return nil, err
+	}
+	return selectEntries(entries, opts), nil
+}
+
+// parseInput detects whether data is a URI list, a base64 subscription, a
+// Clash config or HTML/text with embedded URIs, and parses it accordingly.
+// extract forces URI extraction for text Detect takes for a plain list.
+func parseInput(data []byte, source string, extract bool) ([]ConfigEntry, error) {
+	switch input.Detect(data) {
+	case input.ClashYAML:
+		return clashEntries(data, source)
+	case input.Base64:
+		text, _ := input.DecodeBase64(string(data))
+		data = []byte(text)
+	case input.HTML:
+		extract = true
+	}
+	return scanEntries(bytes.NewReader(data), source, extract)
+}
+
+// readConfigDir reads every .txt file under dir, tagging entries with the
+// file's path relative to dir. A config that appears in several files (same
+// fingerprint) is kept only from the first one in walk order.
+func readConfigDir(dir string, extract bool) ([]ConfigEntry, error) {
 	var entries []ConfigEntry
-	scanner := bufio.NewScanner(src)
-	for scanner.Scan() {
-		line := scanner.Text()
-		cfg, err := parser.ParseLine(line)
+	seen := make(map[string]struct{})
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
 		if err != nil {
-			continue
+			return err
+		}
+		if d.IsDir() || !strings.EqualFold(filepath.Ext(path), ".txt") {
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		source, err := filepath.Rel(dir, path)
+		if err != nil {
+			source = path
+		}
+		fileEntries, err := parseInput(data, source, extract)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		for _, e := range fileEntries {
+			fp := parser.Fingerprint(e.Config)
+			if _, dup := seen[fp]; dup {
+				continue
+			}
+			seen[fp] = struct{}{}
+			entries = append(entries, e)
+		}
+		return nil
+	})
+	return entries, err
+}
+
+// maxReportedParseErrors caps the per-line parse errors scanEntries prints
+// for one source; the rest are only counted.
+const maxReportedParseErrors = 5
+
+// scanEntries parses one URI per line from r. Blank and comment lines are
+// skipped silently; lines that fail to parse are reported on stderr and skipped.
+// With extract, every URI found anywhere in a line is parsed instead.
+func scanEntries(r io.Reader, source string, extract bool) ([]ConfigEntry, error) {
+	var entries []ConfigEntry
+	failed := 0
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 4*1024*1024) // HTML dumps have long lines
+	for n := 1; scanner.Scan(); n++ {
+		uris := []string{scanner.Text()}
+		if extract {
+			uris = parser.ExtractURIs(scanner.Text())
+		}
+		for _, uri := range uris {
+			cfg, err := parser.ParseLine(uri)
+			if errors.Is(err, parser.ErrCommentOrBlank) {
+				continue
+			}
+			if err != nil {
+				if failed++; failed <= maxReportedParseErrors {
+					fmt.Fprintf(os.Stderr, "%sskip%s %s:%d: %s\n",
+						colorYellow, colorReset, source, n, truncate(err.Error(), 80))
+				}
+				continue
+			}
+			entries = append(entries, ConfigEntry{RawURI: uri, Config: cfg, Source: source})
 		}
-		entries = append(entries, ConfigEntry{RawURI: line, Config: cfg})
 	}
-	return entries, scanner.Err()
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if failed > maxReportedParseErrors {
+		fmt.Fprintf(os.Stderr, "%sskip%s %s: %d more unparseable lines\n",
+			colorYellow, colorReset, source, failed-maxReportedParseErrors)
+	}
+	return entries, nil
+}
+
+// readClash parses the proxies: list of a Clash config.yaml. Unsupported proxy
+// types are reported on stderr and skipped. (-f detects Clash files too; this
+// keeps -clash-in for files Detect would not recognize.)
+func readClash(path string, opts inputOptions) ([]ConfigEntry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := clashEntries(data, path)
+	if err != nil {
+		return nil, err
+	}
+	return selectEntries(entries, opts), nil
+}
+
+// clashEntries maps the proxies of a Clash config to entries tagged with source.
+func clashEntries(data []byte, source string) ([]ConfigEntry, error) {
+	configs, skipped, err := clash.Parse(data)
+	if err != nil {
+		return nil, err
+	}
+	for _, sk := range skipped {
+		fmt.Fprintf(os.Stderr, "%sskip%s clash proxy %q (%s): %s\n",
+			colorYellow, colorReset, sk.Name, sk.Type, sk.Reason)
+	}
+	entries := make([]ConfigEntry, len(configs))
+	for i, cfg := range configs {
+		// Give Clash proxies a share URI so they can be served and exported.
+		uri, _ := parser.Marshal(cfg)
+		entries[i] = ConfigEntry{RawURI: uri, Config: cfg, Source: source}
+	}
+	return entries, nil
+}
+
+// selectEntries shuffles and truncates entries according to opts, then makes
+// their names unique with -dup-names. Every reader ends here, so configs
+// re-read by the -watch loop get the same treatment as the first run.
+func selectEntries(entries []ConfigEntry, opts inputOptions) []ConfigEntry {
+	if opts.Shuffle {
+		rand.Shuffle(len(entries), func(i, j int) {
+			entries[i], entries[j] = entries[j], entries[i]
+		})
+	}
+	if opts.Limit > 0 && len(entries) > opts.Limit {
+		entries = entries[:opts.Limit]
+	}
+	if opts.DupNames != "" {
+		if n := dedupeNames(entries, opts.DupNames); n > 0 {
+			fmt.Fprintf(os.Stderr, "%srenamed %d configs with duplicate names%s\n", colorGray, n, colorReset)
+		}
+	}
+	return entries
+}
+
+// sampleEntries returns n entries picked uniformly at random, keeping their
+// original relative order.
+func sampleEntries(entries []ConfigEntry, n int) []ConfigEntry {
+	idx := rand.Perm(len(entries))[:n]
+	sort.Ints(idx)
+	out := make([]ConfigEntry, n)
+	for i, j := range idx {
+		out[i] = entries[j]
+	}
+	return out
+}
+
+// printSampleEstimate extrapolates the sample's alive share to the whole list
+// with a 95% Wilson interval, narrowed by the finite population correction
+// since the sample is drawn without replacement.
+func printSampleEstimate(results []checker.Result, population int) {
+	n := float64(len(results))
+	alive := 0
+	for _, r := range results {
+		if r.Alive {
+			alive++
+		}
+	}
+	p := float64(alive) / n
+	const z = 1.96
+	fpc := math.Sqrt((float64(population) - n) / (float64(population) - 1))
+	denom := 1 + z*z/n
+	center := (p + z*z/(2*n)) / denom
+	half := z * math.Sqrt(p*(1-p)/n+z*z/(4*n*n)) / denom * fpc
+	lo, hi := math.Max(0, center-half), math.Min(1, center+half)
+
+	fmt.Fprintf(os.Stderr, "%sSample:%s %d of %d checked are alive (list has %d)\n",
+		boldOn, colorReset, alive, len(results), population)
+	fmt.Fprintf(os.Stderr, "  estimated alive: %s%.1f%%%s (95%% CI %.1f–%.1f%%) ≈ %d–%d of %d configs\n\n",
+		colorGreen, p*100, colorReset, lo*100, hi*100,
+		int(math.Round(lo*float64(population))), int(math.Round(hi*float64(population))), population)
 }
 
 func buildAliveEntries(results []checker.Result, entries []ConfigEntry) []web.AliveEntry {
@@ -337,42 +1166,178 @@ func buildAliveEntries(results []checker.Result, entries []ConfigEntry) []web.Al
 		}
 		rawURI := ""
 		if r.Index >= 1 && r.Index <= len(entries) {
-			rawURI = entries[r.Index-1].RawURI
+			rawURI = exportURI(r, entries[r.Index-1])
 		}
 		out = append(out, web.AliveEntry{Result: r, RawURI: rawURI})
 	}
 	return out
 }
 
-func printTable(results []checker.Result) {
-	sep := strings.Repeat("─", 120)
-	fmt.Printf("%s%-3s │ %-30s │ %-12s │ %-22s │ %-8s │ %-9s │ %-16s │ %s%s\n",
-		boldOn, "#", "NAME", "PROTO", "SERVER", "STATUS", "LATENCY", "EXIT IP", "COUNTRY", colorReset)
-	fmt.Println(sep)
-
-	for _, r := range results {
-		status := colorRed + "✘ FAIL" + colorReset
-		latency := "-"
-		exitIP := "-"
-		country := "-"
+// tableColumn is one column printTable can render (-columns).
+type tableColumn struct {
+	key    string // name accepted by -columns
+	header string
+	width  int  // visible width the cell is padded to (not applied to the last column)
+	right  bool // right-align
+	value  func(r checker.Result) string
+}
 
+// allColumns is the default table, in display order.
+var allColumns = []tableColumn{
+	{key: "idx", header: "#", width: 3, value: func(r checker.Result) string { return strconv.Itoa(r.Index) }},
+	{key: "name", header: "NAME", width: 30, value: func(r checker.Result) string { return truncate(r.Name, 30) }},
+	{key: "proto", header: "PROTO", width: 12, value: func(r checker.Result) string { return r.Protocol }},
+	{key: "server", header: "SERVER", width: 22, value: func(r checker.Result) string {
+		return truncate(fmt.Sprintf("%s:%d", r.Server, r.Port), 22)
+	}},
+	{key: "status", header: "STATUS", width: 8, value: func(r checker.Result) string {
 		if r.Alive {
-			status = colorGreen + "✔ OK  " + colorReset
-			latency = fmt.Sprintf("%dms", r.Latency.Milliseconds())
-			exitIP = r.ExitIP
-			country = r.Country
+			return colorGreen + "✔ OK" + colorReset
+		}
+		return colorRed + "✘ FAIL" + colorReset
+	}},
+	{key: "latency", header: "LATENCY", width: 9, value: aliveOnly(func(r checker.Result) string {
+		return fmt.Sprintf("%dms", r.Latency.Milliseconds())
+	})},
+	{key: "score", header: "SCORE", width: 5, right: true, value: aliveOnly(func(r checker.Result) string {
+		return fmt.Sprintf("%.0f", r.Score)
+	})},
+	{key: "ip", header: "EXIT IP", width: 16, value: aliveOnly(func(r checker.Result) string { return r.ExitIP })},
+	{key: "cdn", header: "CDN", width: 3, value: aliveOnly(func(r checker.Result) string {
+		if r.IsCDN {
+			return "yes"
+		}
+		return "-"
+	})},
+	{key: "country", header: "COUNTRY", width: 10, value: aliveOnly(func(r checker.Result) string {
+		country := countryLabel(r.Country)
+		if r.RegionMismatch {
+			country += colorYellow + " ≠" + r.ExpectedRegion + colorReset
+		}
+		if checker.CheckIPv6 {
+			country += " " + egressLabel(r.HasIPv6)
 		}
+		return country
+	})},
+}
+
+// tableColumns is what printTable renders; set from -columns.
+var tableColumns = allColumns
+
+// aliveOnly shows "-" for dead results instead of calling value.
+func aliveOnly(value func(r checker.Result) string) func(r checker.Result) string {
+	return func(r checker.Result) string {
+		if !r.Alive {
+			return "-"
+		}
+		return value(r)
+	}
+}
 
-		server := fmt.Sprintf("%s:%d", r.Server, r.Port)
-		name := r.Name
+// parseColumns resolves a comma-separated -columns list against allColumns,
+// keeping the given order.
+func parseColumns(s string) ([]tableColumn, error) {
+	var cols []tableColumn
+	for _, key := range splitList(s) {
+		found := false
+		for _, c := range allColumns {
+			if c.key == strings.ToLower(key) {
+				cols = append(cols, c)
+				found = true
+				break
+			}
+		}
+		if !found {
+			keys := make([]string, len(allColumns))
+			for i, c := range allColumns {
+				keys[i] = c.key
+			}
+			return nil, fmt.Errorf("unknown column %q (available: %s)", key, strings.Join(keys, ", "))
+		}
+	}
+	if len(cols) == 0 {
+		return nil, fmt.Errorf("no columns given")
+	}
+	return cols, nil
+}
 
-		fmt.Printf("%-3d │ %-30s │ %-12s │ %-22s │ %s │ %-9s │ %-16s │ %s\n",
-			r.Index, truncate(name, 30), r.Protocol, truncate(server, 22),
-			status, latency, exitIP, country)
+// tableSep separates the cells of the regular table.
+const tableSep = " │ "
+
+// tableRow joins cells with sep, padding every cell but the last.
+func tableRow(cols []tableColumn, cells []string, sep string) string {
+	var b strings.Builder
+	for i, c := range cols {
+		if i > 0 {
+			b.WriteString(sep)
+		}
+		cell := cells[i]
+		if i == len(cols)-1 {
+			b.WriteString(cell)
+			continue
+		}
+		pad := strings.Repeat(" ", max(0, c.width-visibleLen(cell)))
+		if c.right {
+			b.WriteString(pad + cell)
+		} else {
+			b.WriteString(cell + pad)
+		}
+	}
+	return b.String()
+}
+
+// visibleLen counts the runes of s that take up space, skipping ANSI color codes.
+func visibleLen(s string) int {
+	n := 0
+	inEscape := false
+	for _, r := range s {
+		switch {
+		case r == '\033':
+			inEscape = true
+		case inEscape:
+			if r == 'm' {
+				inEscape = false
+			}
+		default:
+			n++
+		}
+	}
+	return n
+}
+
+func printTable(results []checker.Result) {
+	if compact {
+		printCompactTable(results)
+		return
+	}
+	cols := tableColumns
+	headers := make([]string, len(cols))
+	for i, c := range cols {
+		headers[i] = c.header
+	}
+	sep := strings.Repeat("─", tableWidth(cols, tableSep))
+	fmt.Printf("%s%s%s\n", boldOn, tableRow(cols, headers, tableSep), colorReset)
+	fmt.Println(sep)
+
+	for _, r := range results {
+		cells := make([]string, len(cols))
+		for i, c := range cols {
+			cells[i] = c.value(r)
+		}
+		fmt.Println(tableRow(cols, cells, tableSep))
 
 		if !r.Alive && r.Error != "" {
 			fmt.Printf("    │ %serror: %s%s\n", colorRed, truncate(r.Error, 100), colorReset)
 		}
+		if r.Warning != "" {
+			fmt.Printf("    │ %swarning: %s%s\n", colorYellow, truncate(r.Warning, 100), colorReset)
+		}
+		if len(r.Checks) > 0 {
+			fmt.Printf("    │ %s\n", checksSummary(r.Checks))
+		}
+		if r.DownloadMbps > 0 || r.UploadMbps > 0 {
+			fmt.Printf("    │ %s\n", speedSummary(r))
+		}
 	}
 
 	fmt.Println(sep)
@@ -387,41 +1352,385 @@ func printTable(results []checker.Result) {
 		boldOn, len(results), alive, colorReset, len(results)-alive)
 }
 
-func printJSON(results []checker.Result) {
-	type jsonResult struct {
-		Index     int    `json:"index"`
-		Name      string `json:"name"`
-		Protocol  string `json:"protocol"`
-		Server    string `json:"server"`
-		Port      int    `json:"port"`
-		Alive     bool   `json:"alive"`
-		LatencyMs int64  `json:"latency_ms,omitempty"`
-		ExitIP    string `json:"exit_ip,omitempty"`
-		Country   string `json:"country,omitempty"`
-		Error     string `json:"error,omitempty"`
+// extremesCount is how many configs printExtremes lists at each end.
+const extremesCount = 5
+
+// printExtremes lists the fastest and slowest alive configs by latency.
+func printExtremes(results []checker.Result) {
+	var alive []checker.Result
+	for _, r := range results {
+		if r.Alive {
+			alive = append(alive, r)
+		}
+	}
+	if len(alive) == 0 {
+		return
 	}
+	sort.SliceStable(alive, func(i, j int) bool { return alive[i].Latency < alive[j].Latency })
 
-	out := make([]jsonResult, len(results))
-	for i, r := range results {
-		out[i] = jsonResult{
-			Index:    r.Index,
-			Name:     r.Name,
-			Protocol: r.Protocol,
-			Server:   r.Server,
-			Port:     r.Port,
-			Alive:    r.Alive,
-			ExitIP:   r.ExitIP,
-			Country:  r.Country,
-			Error:    r.Error,
+	n := extremesCount
+	if n > len(alive) {
+		n = len(alive)
+	}
+	fmt.Printf("\n%sFastest:%s\n", colorGreen, colorReset)
+	for _, r := range alive[:n] {
+		printExtremeLine(r)
+	}
+	// With few alive configs the slowest list would repeat the fastest one.
+	if len(alive) <= extremesCount {
+		return
+	}
+	fmt.Printf("%sSlowest:%s\n", colorRed, colorReset)
+	for i := len(alive) - 1; i >= len(alive)-n; i-- {
+		printExtremeLine(alive[i])
+	}
+}
+
+func printExtremeLine(r checker.Result) {
+	country := r.Country
+	if country == "" {
+		country = "-"
+	}
+	fmt.Printf("  %s%6dms%s  %-30s %s\n",
+		colorYellow, r.Latency.Milliseconds(), colorReset, truncate(r.Name, 30), country)
+}
+
+// printProtocolStats prints checked/alive counts and median latency of alive
+// configs per protocol, protocols in alphabetical order.
+func printProtocolStats(results []checker.Result) {
+	type stats struct {
+		checked   int
+		latencies []time.Duration
+	}
+	byProto := make(map[string]*stats)
+	var protos []string
+	for _, r := range results {
+		st := byProto[r.Protocol]
+		if st == nil {
+			st = &stats{}
+			byProto[r.Protocol] = st
+			protos = append(protos, r.Protocol)
+		}
+		st.checked++
+		if r.Alive {
+			st.latencies = append(st.latencies, r.Latency)
+		}
+	}
+	sort.Strings(protos)
+
+	fmt.Printf("\n%s%-12s %8s %8s %8s %10s%s\n", boldOn, "PROTOCOL", "CHECKED", "ALIVE", "ALIVE %", "MEDIAN", colorReset)
+	for _, p := range protos {
+		st := byProto[p]
+		median := "-"
+		if len(st.latencies) > 0 {
+			median = fmt.Sprintf("%dms", medianDuration(st.latencies).Milliseconds())
 		}
+		fmt.Printf("%-12s %8d %8d %7.0f%% %10s\n",
+			p, st.checked, len(st.latencies), 100*float64(len(st.latencies))/float64(st.checked), median)
+	}
+}
+
+// printFailPhases breaks the dead configs down by the phase they failed in,
+// to tell e.g. SNI/fingerprint trouble (tls-handshake) from dead servers
+// (tcp-connect).
+func printFailPhases(results []checker.Result) {
+	counts := make(map[string]int)
+	dead := 0
+	for _, r := range results {
 		if r.Alive {
-			out[i].LatencyMs = r.Latency.Milliseconds()
+			continue
+		}
+		dead++
+		phase := r.FailPhase
+		if phase == "" {
+			phase = "other"
+		}
+		counts[phase]++
+	}
+	if dead == 0 {
+		return
+	}
+
+	fmt.Printf("\n%s%-14s %8s %8s%s\n", boldOn, "FAILED AT", "DEAD", "DEAD %", colorReset)
+	for _, phase := range append(checker.FailPhases, "other") {
+		if n := counts[phase]; n > 0 {
+			fmt.Printf("%-14s %8d %7.0f%%\n", phase, n, 100*float64(n)/float64(dead))
+		}
+	}
+}
+
+// sharedExitMax is the -shared-exit threshold: exit IPs used by more alive
+// configs than this are listed after the table (0 = off).
+var sharedExitMax int
+
+// sharedExitNames is how many config names printSharedExits shows per IP.
+const sharedExitNames = 3
+
+// printSharedExits lists exit IPs shared by more than sharedExitMax alive
+// configs. Such configs are most likely one backend under different names and
+// add no redundancy to each other.
+func printSharedExits(results []checker.Result) {
+	if sharedExitMax <= 0 {
+		return
+	}
+	byIP := make(map[string][]string)
+	for _, r := range results {
+		if r.Alive && r.ExitIP != "" {
+			byIP[r.ExitIP] = append(byIP[r.ExitIP], r.Name)
+		}
+	}
+	var ips []string
+	for ip, names := range byIP {
+		if len(names) > sharedExitMax {
+			ips = append(ips, ip)
+		}
+	}
+	if len(ips) == 0 {
+		return
+	}
+	sort.Slice(ips, func(i, j int) bool {
+		if ni, nj := len(byIP[ips[i]]), len(byIP[ips[j]]); ni != nj {
+			return ni > nj
+		}
+		return ips[i] < ips[j]
+	})
+
+	fmt.Printf("\n%sShared exit IPs (likely the same backend):%s\n", colorYellow, colorReset)
+	for _, ip := range ips {
+		names := byIP[ip]
+		var shown []string
+		for _, n := range names {
+			if len(shown) == sharedExitNames {
+				break
+			}
+			shown = append(shown, truncate(n, 20))
+		}
+		more := ""
+		if len(names) > len(shown) {
+			more = fmt.Sprintf(", +%d more", len(names)-len(shown))
+		}
+		fmt.Printf("  %-16s %3d configs  %s%s\n", ip, len(names), strings.Join(shown, ", "), more)
+	}
+}
+
+// medianDuration returns the median of ds (mean of the middle pair for even
+// lengths). ds is sorted in place.
+func medianDuration(ds []time.Duration) time.Duration {
+	sort.Slice(ds, func(i, j int) bool { return ds[i] < ds[j] })
+	mid := len(ds) / 2
+	if len(ds)%2 == 0 {
+		return (ds[mid-1] + ds[mid]) / 2
+	}
+	return ds[mid]
+}
+
+// speedSummary renders the -speedtest figures, e.g. "speed ↓ 48.2 Mbps ↑ 9.7 Mbps".
+func speedSummary(r checker.Result) string {
+	s := fmt.Sprintf("speed ↓ %.1f Mbps", r.DownloadMbps)
+	if checker.SpeedTestUpload {
+		s += fmt.Sprintf(" ↑ %.1f Mbps", r.UploadMbps)
+	}
+	return s
+}
+
+// checksSummary renders the aggregate of extra-target outcomes, e.g. "checks 2/3 ok (✘ google.com)".
+func checksSummary(checks map[string]checker.CheckOutcome) string {
+	targets := make([]string, 0, len(checks))
+	for t := range checks {
+		targets = append(targets, t)
+	}
+	sort.Strings(targets)
+
+	ok := 0
+	var failed []string
+	for _, t := range targets {
+		if checks[t].OK {
+			ok++
+		} else {
+			failed = append(failed, "✘ "+t)
 		}
 	}
+	color := colorGreen
+	if ok < len(checks) {
+		color = colorYellow
+	}
+	s := fmt.Sprintf("%schecks %d/%d ok%s", color, ok, len(checks), colorReset)
+	if len(failed) > 0 {
+		s += " (" + strings.Join(failed, ", ") + ")"
+	}
+	return s
+}
+
+// jsonResult is the -json output schema; -diff reads the same schema back.
+type jsonResult struct {
+	Index       int     `json:"index" yaml:"index"`
+	Name        string  `json:"name" yaml:"name"`
+	Protocol    string  `json:"protocol" yaml:"protocol"`
+	Server      string  `json:"server" yaml:"server"`
+	Port        int     `json:"port" yaml:"port"`
+	Fingerprint string  `json:"fingerprint,omitempty" yaml:"fingerprint,omitempty"`
+	Alive       bool    `json:"alive" yaml:"alive"`
+	LatencyMs   int64   `json:"latency_ms,omitempty" yaml:"latency_ms,omitempty"`
+	Score       float64 `json:"score,omitempty" yaml:"score,omitempty"`
+	ConnectMs   int64   `json:"connect_ms,omitempty" yaml:"connect_ms,omitempty"`
+	TLSMs       int64   `json:"tls_ms,omitempty" yaml:"tls_ms,omitempty"`
+	TTFBMs      int64   `json:"ttfb_ms,omitempty" yaml:"ttfb_ms,omitempty"`
+	TCPPingMs   int64   `json:"tcp_ping_ms,omitempty" yaml:"tcp_ping_ms,omitempty"`
+	ExitIP      string  `json:"exit_ip,omitempty" yaml:"exit_ip,omitempty"`
+	Country     string  `json:"country,omitempty" yaml:"country,omitempty"`
+	IsCDN       bool    `json:"is_cdn,omitempty" yaml:"is_cdn,omitempty"`
+	Error       string  `json:"error,omitempty" yaml:"error,omitempty"`
+	FailPhase   string  `json:"fail_phase,omitempty" yaml:"fail_phase,omitempty"`
+	HasIPv6     *bool   `json:"has_ipv6,omitempty" yaml:"has_ipv6,omitempty"` // only with -check-ipv6
+	Warning     string  `json:"warning,omitempty" yaml:"warning,omitempty"`
+	XrayLog     string  `json:"xray_log,omitempty" yaml:"xray_log,omitempty"`
+
+	ExpectedRegion string `json:"expected_region,omitempty" yaml:"expected_region,omitempty"`
+	RegionMismatch bool   `json:"region_mismatch,omitempty" yaml:"region_mismatch,omitempty"`
+
+	DownloadMbps float64 `json:"download_mbps,omitempty" yaml:"download_mbps,omitempty"` // only with -speedtest
+	UploadMbps   float64 `json:"upload_mbps,omitempty" yaml:"upload_mbps,omitempty"`     // only with -speedtest-upload
+
+	Checks    map[string]jsonCheck `json:"checks,omitempty" yaml:"checks,omitempty"`
+	KeepAlive *jsonCheck           `json:"keepalive,omitempty" yaml:"keepalive,omitempty"` // only with -keepalive
+	Repeat    *jsonRepeat          `json:"repeat,omitempty" yaml:"repeat,omitempty"`       // only with -repeat
+}
 
+// jsonCheck is the per-target detail of -checks in JSON output.
+type jsonCheck struct {
+	OK        bool   `json:"ok" yaml:"ok"`
+	Status    int    `json:"status,omitempty" yaml:"status,omitempty"`
+	LatencyMs int64  `json:"latency_ms,omitempty" yaml:"latency_ms,omitempty"`
+	Error     string `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+func toJSONResults(results []checker.Result) []jsonResult {
+	out := make([]jsonResult, len(results))
+	for i, r := range results {
+		out[i] = toJSONResult(r)
+	}
+	return out
+}
+
+func toJSONResult(r checker.Result) jsonResult {
+	out := jsonResult{
+		Index:       r.Index,
+		Name:        r.Name,
+		Protocol:    r.Protocol,
+		Server:      r.Server,
+		Port:        r.Port,
+		Fingerprint: r.Fingerprint,
+		Alive:       r.Alive,
+		ExitIP:      r.ExitIP,
+		Country:     r.Country,
+		IsCDN:       r.IsCDN,
+		Error:       r.Error,
+		FailPhase:   r.FailPhase,
+		Warning:     r.Warning,
+		XrayLog:     r.XrayLog,
+		TCPPingMs:   r.TCPPing.Milliseconds(),
+
+		ExpectedRegion: r.ExpectedRegion,
+		RegionMismatch: r.RegionMismatch,
+	}
+	if r.Alive && checker.CheckIPv6 {
+		hasIPv6 := r.HasIPv6
+		out.HasIPv6 = &hasIPv6
+	}
+	if r.Alive {
+		out.LatencyMs = r.Latency.Milliseconds()
+		out.Score = math.Round(r.Score*10) / 10
+		out.ConnectMs = r.ConnectTime.Milliseconds()
+		out.TLSMs = r.TLSTime.Milliseconds()
+		out.TTFBMs = r.TTFB.Milliseconds()
+		out.DownloadMbps = math.Round(r.DownloadMbps*10) / 10
+		out.UploadMbps = math.Round(r.UploadMbps*10) / 10
+	}
+	if len(r.Checks) > 0 {
+		out.Checks = make(map[string]jsonCheck, len(r.Checks))
+		for t, c := range r.Checks {
+			out.Checks[t] = toJSONCheck(c)
+		}
+	}
+	if r.KeepAlive != nil {
+		ka := toJSONCheck(*r.KeepAlive)
+		out.KeepAlive = &ka
+	}
+	if r.Repeat != nil {
+		out.Repeat = toJSONRepeat(*r.Repeat)
+	}
+	return out
+}
+
+func toJSONCheck(c checker.CheckOutcome) jsonCheck {
+	return jsonCheck{
+		OK:        c.OK,
+		Status:    c.Status,
+		LatencyMs: c.Latency.Milliseconds(),
+		Error:     c.Error,
+	}
+}
+
+func printJSON(results []checker.Result) {
 	enc := json.NewEncoder(os.Stdout)
 	enc.SetIndent("", "  ")
-	_ = enc.Encode(out)
+	_ = enc.Encode(toJSONResults(results))
+}
+
+// countryLabel renders a country code, with its flag when -emoji is set.
+func countryLabel(code string) string {
+	if !emoji || code == "" {
+		return code
+	}
+	return flagEmoji(code) + " " + code
+}
+
+// flagEmoji maps an ISO 3166-1 alpha-2 code to its pair of regional indicator
+// symbols, or "" when code isn't two ASCII letters.
+func flagEmoji(code string) string {
+	if len(code) != 2 {
+		return ""
+	}
+	var b strings.Builder
+	for _, c := range strings.ToUpper(code) {
+		if c < 'A' || c > 'Z' {
+			return ""
+		}
+		b.WriteRune(0x1F1E6 + (c - 'A'))
+	}
+	return b.String()
+}
+
+// egressLabel marks a config's egress in the table when -check-ipv6 is set.
+func egressLabel(hasIPv6 bool) string {
+	if hasIPv6 {
+		return "[v4+v6]"
+	}
+	return "[v4 only]"
+}
+
+func validLogLevel(level string) bool {
+	return contains(xray.LogLevels, level)
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// splitList splits a comma-separated flag value, dropping empty items.
+func splitList(s string) []string {
+	var out []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
 }
 
 func truncate(s string, n int) string {
@@ -432,11 +1741,13 @@ func truncate(s string, n int) string {
 	return string(runes[:n-1]) + "…"
 }
 
-func aliveEntryKey(e web.AliveEntry) string {
-	if e.RawURI != "" {
-		return e.RawURI
+// isTerminal reports whether f is a character device (an interactive terminal).
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	if err != nil {
+		return false
 	}
-	return fmt.Sprintf("%s:%d", e.Result.Server, e.Result.Port)
+	return fi.Mode()&os.ModeCharDevice != 0
 }
 
 func disableColors() {
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"vpn_checker/internal/parser"
+)
+
+// stringList is a repeatable string flag (-url a -url b).
+type stringList []string
+
+func (l *stringList) String() string { return strings.Join(*l, ",") }
+
+func (l *stringList) Set(v string) error {
+	*l = append(*l, v)
+	return nil
+}
+
+// subscriptionFetchTimeout bounds each -url download.
+const subscriptionFetchTimeout = 30 * time.Second
+
+// maxSubscriptionBytes caps a downloaded subscription body.
+const maxSubscriptionBytes = 16 << 20
+
+// subscriptionClient downloads -url subscriptions. These are the tool's own
+// direct requests, so unlike the per-config tunnels they go through the
+// HTTP_PROXY/HTTPS_PROXY/NO_PROXY proxy of the machine when one is set.
+var subscriptionClient = &http.Client{
+	Timeout:   subscriptionFetchTimeout,
+	Transport: &http.Transport{Proxy: http.ProxyFromEnvironment},
+}
+
+// fetchSubscription downloads a subscription URL and parses its configs in
+// whatever format it serves (see parseInput).
+func fetchSubscription(url string, extract bool) ([]ConfigEntry, error) {
+	client := subscriptionClient
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "vpn-checker/1.0")
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("http status %d", resp.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxSubscriptionBytes))
+	if err != nil {
+		return nil, err
+	}
+	return parseInput(body, url, extract)
+}
+
+// readSources reads -f (when set) followed by every -url, drops configs
+// already seen in an earlier source (same fingerprint), then applies opts.
+// A URL that fails to download is reported and skipped.
+func readSources(file string, urls []string, opts inputOptions) ([]ConfigEntry, error) {
+	var lists [][]ConfigEntry
+	if file != "" {
+		entries, err := readConfigs(file, inputOptions{Extract: opts.Extract})
+		if err != nil {
+			return nil, err
+		}
+		lists = append(lists, entries)
+	}
+	for _, url := range urls {
+		entries, err := fetchSubscription(url, opts.Extract)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%sskip%s %s: %v\n", colorYellow, colorReset, url, err)
+			continue
+		}
+		lists = append(lists, entries)
+	}
+	return selectEntries(mergeEntries(lists...), opts), nil
+}
+
+// mergeEntries concatenates lists keeping only the first config per fingerprint.
+func mergeEntries(lists ...[]ConfigEntry) []ConfigEntry {
+	var out []ConfigEntry
+	seen := make(map[string]struct{})
+	for _, list := range lists {
+		for _, e := range list {
+			fp := parser.Fingerprint(e.Config)
+			if _, dup := seen[fp]; dup {
+				continue
+			}
+			seen[fp] = struct{}{}
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+// writeMerged writes entries, unchecked, as one base64 subscription to path
+// (stdout when path is empty).
+func writeMerged(path string, entries []ConfigEntry) (int, error) {
+	var uris []string
+	for _, e := range mergeEntries(entries) {
+		uri := e.RawURI
+		if uri == "" {
+			var err error
+			if uri, err = parser.Marshal(e.Config); err != nil {
+				continue
+			}
+		}
+		uris = append(uris, uri)
+	}
+	body := base64.StdEncoding.EncodeToString([]byte(strings.Join(uris, "\n")))
+	if path == "" {
+		_, err := fmt.Println(body)
+		return len(uris), err
+	}
+	return len(uris), os.WriteFile(path, []byte(body), 0o644)
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// TestFetchSubscriptionUsesEnvProxy checks that -url downloads go through
+// HTTP_PROXY. net/http reads the proxy variables once per process, so this
+// must stay the only test in the package that sets them.
+func TestFetchSubscriptionUsesEnvProxy(t *testing.T) {
+	const sub = "trojan://secret@trojan.example.com:443?sni=trojan.example.com#via-proxy\n"
+	var (
+		mu  sync.Mutex
+		got []string
+	)
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		got = append(got, r.URL.String())
+		mu.Unlock()
+		w.Write([]byte(sub))
+	}))
+	defer proxy.Close()
+	t.Setenv("HTTP_PROXY", proxy.URL)
+	t.Setenv("http_proxy", proxy.URL)
+	t.Setenv("NO_PROXY", "")
+	t.Setenv("no_proxy", "")
+
+	// The host does not resolve: only a proxy can answer it.
+	entries, err := fetchSubscription("http://subscription.invalid/list", false)
+	if err != nil {
+		t.Fatalf("fetch through HTTP_PROXY: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Config.GetName() != "via-proxy" {
+		t.Errorf("entries = %+v, want the one config served by the proxy", entries)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(got) != 1 || got[0] != "http://subscription.invalid/list" {
+		t.Errorf("proxy saw %v, want one request for the subscription URL", got)
+	}
+}
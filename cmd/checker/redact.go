@@ -0,0 +1,100 @@
+package main
+
+import (
+	"strings"
+
+	"vpn_checker/internal/checker"
+	"vpn_checker/internal/parser"
+)
+
+// redact masks config secrets in everything printed or written about results
+// (-redact): the table/JSON output, -stream-out lines and the -diff report.
+var redact bool
+
+// secretsOf returns the credentials of cfg that -redact masks: UUIDs,
+// passwords and reality keys. Server, port and protocol stay visible.
+func secretsOf(cfg parser.ProxyConfig) []string {
+	var secrets []string
+	switch c := cfg.(type) {
+	case *parser.VlessConfig:
+		secrets = []string{c.UUID, c.PublicKey, c.ShortID}
+	case *parser.VmessConfig:
+		secrets = []string{c.UUID, c.PublicKey, c.ShortID}
+	case *parser.TrojanConfig:
+		secrets = []string{c.Password, c.PublicKey, c.ShortID, c.SSPassword}
+	case *parser.SSConfig:
+		secrets = []string{c.Password}
+	case *parser.SocksConfig:
+		secrets = []string{c.Username, c.Password}
+	case *parser.HttpConfig:
+		secrets = []string{c.Username, c.Password}
+	}
+	out := secrets[:0]
+	for _, s := range secrets {
+		if s != "" {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// maskSecret keeps the first and last 4 characters of s, enough to tell
+// secrets apart in a shared report. Short secrets are masked entirely.
+func maskSecret(s string) string {
+	r := []rune(s)
+	if len(r) <= 12 {
+		return strings.Repeat("*", len(r))
+	}
+	return string(r[:4]) + "…" + string(r[len(r)-4:])
+}
+
+// redactResults applies redactFor to every result, returning copies so that
+// results itself is left intact for -sub-out and friends.
+func redactResults(results []checker.Result, entries []ConfigEntry) []checker.Result {
+	out := make([]checker.Result, len(results))
+	for i, r := range results {
+		out[i] = redactFor(r, entries)
+	}
+	return out
+}
+
+// redactFor returns r with the secrets of its config masked wherever they
+// appear in the printed text fields (names, errors, xray logs) when -redact is
+// on, and r unchanged otherwise.
+func redactFor(r checker.Result, entries []ConfigEntry) checker.Result {
+	if !redact || r.Index < 1 || r.Index > len(entries) {
+		return r
+	}
+	return redactResult(r, secretsOf(entries[r.Index-1].Config))
+}
+
+// minRedactLen is the shortest secret masked inside free text. Shorter ones
+// (reality shortIds like "0" or "ab", socks users like "a") would match digits
+// of IPs and words of error messages, and are too short to be worth hiding.
+const minRedactLen = 8
+
+func redactResult(r checker.Result, secrets []string) checker.Result {
+	pairs := make([]string, 0, 2*len(secrets))
+	for _, s := range secrets {
+		if len([]rune(s)) >= minRedactLen {
+			pairs = append(pairs, s, maskSecret(s))
+		}
+	}
+	if len(pairs) == 0 {
+		return r
+	}
+	rep := strings.NewReplacer(pairs...)
+	r.Name = rep.Replace(r.Name)
+	r.Error = rep.Replace(r.Error)
+	r.Warning = rep.Replace(r.Warning)
+	r.XrayLog = rep.Replace(r.XrayLog)
+	if len(r.Checks) > 0 {
+		checks := make(map[string]checker.CheckOutcome, len(r.Checks))
+		for t, c := range r.Checks {
+			c.Error = rep.Replace(c.Error)
+			checks[t] = c
+		}
+		r.Checks = checks
+	}
+	return r
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"vpn_checker/internal/checker"
+	"vpn_checker/internal/parser"
+)
+
+func TestRedactShortSecrets(t *testing.T) {
+	const uuid = "11111111-2222-3333-4444-555555555555"
+	for _, sid := range []string{"0", "ab"} {
+		t.Run("sid="+sid, func(t *testing.T) {
+			cfg, err := parser.ParseLine("vless://" + uuid + "@10.0.0.1:443?type=tcp&security=reality&sni=www.microsoft.com&pbk=PUBLICKEYPUBLICKEY&sid=" + sid + "#lab")
+			if err != nil {
+				t.Fatal(err)
+			}
+			r := checker.Result{
+				Index: 1,
+				Name:  "lab",
+				Error: "dial tcp 10.0.0.1:443: connection refused (about a user " + uuid + ")",
+			}
+			prev := redact
+			redact = true
+			defer func() { redact = prev }()
+
+			got := redactFor(r, []ConfigEntry{{Config: cfg}})
+			if strings.Contains(got.Error, uuid) {
+				t.Errorf("UUID left in %q", got.Error)
+			}
+			want := "dial tcp 10.0.0.1:443: connection refused (about a user " + maskSecret(uuid) + ")"
+			if got.Error != want {
+				t.Errorf("short shortId mangled the text:\n got %q\nwant %q", got.Error, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+
+	"vpn_checker/internal/checker"
+	"vpn_checker/internal/parser"
+)
+
+// regionExpectations maps a config fingerprint or name to the country codes it
+// should exit in (-expect-regions). Checked before the URI's own region= parameter.
+var regionExpectations map[string]string
+
+// loadRegionExpectations reads an -expect-regions file: one "<codes> <config>"
+// per line, where codes is e.g. "DE" or "DE,NL" and config is a fingerprint or
+// a display name (which may contain spaces). Blank lines and # comments are skipped.
+func loadRegionExpectations(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	out := make(map[string]string)
+	sc := bufio.NewScanner(f)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		codes, key, ok := strings.Cut(line, " ")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("line %d: want \"<country codes> <fingerprint or name>\"", n)
+		}
+		out[key] = codes
+	}
+	return out, sc.Err()
+}
+
+// expectedRegion returns the country codes e is expected to exit in, or "".
+func expectedRegion(e ConfigEntry) string {
+	if codes, ok := regionExpectations[parser.Fingerprint(e.Config)]; ok {
+		return codes
+	}
+	if codes, ok := regionExpectations[e.Config.GetName()]; ok {
+		return codes
+	}
+	return uriParam(e.RawURI, "region")
+}
+
+// uriParam returns a query parameter of a URL-style share link. vmess keeps
+// its parameters in base64 JSON, so it never has any.
+func uriParam(rawURI, key string) string {
+	if strings.HasPrefix(rawURI, "vmess://") {
+		return ""
+	}
+	rest, _, _ := strings.Cut(rawURI, "#")
+	u, err := url.Parse(rest)
+	if err != nil {
+		return ""
+	}
+	return u.Query().Get(key)
+}
+
+// markRegion compares r's exit country with the expectation for its entry.
+func markRegion(r *checker.Result, entries []ConfigEntry) {
+	if r.Index >= 1 && r.Index <= len(entries) {
+		r.ExpectRegion(expectedRegion(entries[r.Index-1]))
+	}
+}
+
+// printRegionMismatches lists alive configs that exit outside their expected region.
+func printRegionMismatches(results []checker.Result) {
+	var mismatched []checker.Result
+	for _, r := range results {
+		if r.RegionMismatch {
+			mismatched = append(mismatched, r)
+		}
+	}
+	if len(mismatched) == 0 {
+		return
+	}
+	fmt.Printf("\n%sRegion mismatches:%s\n", colorYellow, colorReset)
+	for _, r := range mismatched {
+		fmt.Printf("  %-30s expected %s, exits in %s\n", truncate(r.Name, 30), r.ExpectedRegion, r.Country)
+	}
+}
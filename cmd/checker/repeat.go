@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+
+	"vpn_checker/internal/checker"
+)
+
+// repeatRuns and weighted are the -repeat and -weighted load-testing options.
+var (
+	repeatRuns int
+	weighted   bool
+)
+
+// repeatCounts returns how often each entry is checked: repeatRuns times
+// each, or with -weighted a total of repeatRuns×len(entries) attempts drawn
+// at random by the weight= URI parameter (default 1), every entry at least once.
+func repeatCounts(entries []ConfigEntry) []int {
+	if repeatRuns < 2 {
+		return nil
+	}
+	counts := make([]int, len(entries))
+	if !weighted {
+		for i := range counts {
+			counts[i] = repeatRuns
+		}
+		return counts
+	}
+
+	weights := make([]float64, len(entries))
+	var sum float64
+	for i, e := range entries {
+		w, err := strconv.ParseFloat(uriParam(e.RawURI, "weight"), 64)
+		if err != nil || w <= 0 || math.IsInf(w, 0) {
+			w = 1
+		}
+		weights[i] = w
+		sum += w
+		counts[i] = 1
+	}
+	for n := len(entries) * (repeatRuns - 1); n > 0; n-- {
+		x := rand.Float64() * sum
+		i := 0
+		for ; i < len(weights)-1; i++ {
+			if x -= weights[i]; x < 0 {
+				break
+			}
+		}
+		counts[i]++
+	}
+	return counts
+}
+
+// jsonRepeat is the -repeat block of the JSON output.
+type jsonRepeat struct {
+	Runs            int     `json:"runs" yaml:"runs"`
+	OK              int     `json:"ok" yaml:"ok"`
+	SuccessRate     float64 `json:"success_rate" yaml:"success_rate"`
+	LatencyMinMs    int64   `json:"latency_min_ms,omitempty" yaml:"latency_min_ms,omitempty"`
+	LatencyMedianMs int64   `json:"latency_median_ms,omitempty" yaml:"latency_median_ms,omitempty"`
+	LatencyP90Ms    int64   `json:"latency_p90_ms,omitempty" yaml:"latency_p90_ms,omitempty"`
+	LatencyMaxMs    int64   `json:"latency_max_ms,omitempty" yaml:"latency_max_ms,omitempty"`
+}
+
+func toJSONRepeat(s checker.RepeatStats) *jsonRepeat {
+	return &jsonRepeat{
+		Runs:            s.Runs,
+		OK:              s.OK,
+		SuccessRate:     math.Round(s.SuccessRate()*1000) / 1000,
+		LatencyMinMs:    s.LatencyMin.Milliseconds(),
+		LatencyMedianMs: s.LatencyMedian.Milliseconds(),
+		LatencyP90Ms:    s.LatencyP90.Milliseconds(),
+		LatencyMaxMs:    s.LatencyMax.Milliseconds(),
+	}
+}
+
+// printRepeatStats lists success rate and latency spread of repeated configs,
+// least reliable first.
+func printRepeatStats(results []checker.Result) {
+	var repeated []checker.Result
+	for _, r := range results {
+		if r.Repeat != nil {
+			repeated = append(repeated, r)
+		}
+	}
+	if len(repeated) == 0 {
+		return
+	}
+	sort.SliceStable(repeated, func(i, j int) bool {
+		return repeated[i].Repeat.SuccessRate() < repeated[j].Repeat.SuccessRate()
+	})
+	fmt.Printf("\n%sRepeat stats:%s\n", colorCyan, colorReset)
+	fmt.Printf("%-30s %7s %6s %8s %8s %8s\n", "NAME", "OK", "RATE", "MIN", "P50", "P90")
+	for _, r := range repeated {
+		s := r.Repeat
+		fmt.Printf("%-30s %3d/%-3d %5.0f%% %6dms %6dms %6dms\n",
+			truncate(r.Name, 30), s.OK, s.Runs, 100*s.SuccessRate(),
+			s.LatencyMin.Milliseconds(), s.LatencyMedian.Milliseconds(), s.LatencyP90.Milliseconds())
+	}
+}
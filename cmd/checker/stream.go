@@ -0,0 +1,40 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"vpn_checker/internal/checker"
+)
+
+// resultStream appends every finished result to a file as one JSON line
+// (-stream-out). Each line is a single write, so the file can be tailed and
+// stays valid up to the last completed check if the run is interrupted.
+type resultStream struct {
+	f   *os.File
+	enc *json.Encoder
+}
+
+// stream is the active -stream-out sink, nil when the flag is not set.
+var stream *resultStream
+
+func openResultStream(path string) (*resultStream, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &resultStream{f: f, enc: json.NewEncoder(f)}, nil
+}
+
+// Write encodes r as a single line. Callers serialize calls (CheckAll's
+// onResult already runs under a mutex).
+func (s *resultStream) Write(r checker.Result) {
+	if err := s.enc.Encode(toJSONResult(r)); err != nil {
+		fmt.Fprintf(os.Stderr, "%sstream-out:%s %v\n", colorYellow, colorReset, err)
+	}
+}
+
+func (s *resultStream) Close() error {
+	return s.f.Close()
+}
@@ -345,11 +345,9 @@ func runCheckLoop(ctx context.Context, rc *pool.RedisClient, srv *dashboard.Serv
 
 		var (
 			wg      sync.WaitGroup
-			mu      sync.Mutex
 			done    atomic.Int64
 			deadCnt atomic.Int64
 		)
-		_ = mu
 
 		for i := 0; i < workers; i++ {
 			wg.Add(1)
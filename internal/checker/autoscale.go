@@ -0,0 +1,107 @@
+package checker
+
+import (
+	"os"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AutoWorkersMax, when > 0, makes CheckAll adapt its concurrency instead of
+// running a fixed number of workers: it starts at the requested worker count
+// and, after every window of finished checks, grows by a quarter while alive
+// latencies stay near the best window seen and the load average is below the
+// CPU count, or shrinks by a quarter when either degrades. The count stays
+// within [1, AutoWorkersMax]. Not used with GeoWorkers.
+var AutoWorkersMax int
+
+// workerGate is a resizable semaphore fed with each check's outcome.
+type workerGate struct {
+	mu       sync.Mutex
+	cond     *sync.Cond
+	limit    int
+	active   int
+	max      int
+	window   []time.Duration // alive latencies since the last adjustment
+	finished int             // checks finished since the last adjustment
+	baseline time.Duration   // best window median so far
+}
+
+func newWorkerGate(start, maxWorkers int) *workerGate {
+	g := &workerGate{limit: min(max(start, 1), maxWorkers), max: maxWorkers}
+	g.cond = sync.NewCond(&g.mu)
+	return g
+}
+
+// acquire blocks until fewer than limit workers are busy.
+func (g *workerGate) acquire() {
+	g.mu.Lock()
+	for g.active >= g.limit {
+		g.cond.Wait()
+	}
+	g.active++
+	g.mu.Unlock()
+}
+
+// release frees a slot without feedback (the worker found no job).
+func (g *workerGate) release() {
+	g.mu.Lock()
+	g.active--
+	g.cond.Broadcast()
+	g.mu.Unlock()
+}
+
+// done frees a slot and feeds r into the controller.
+func (g *workerGate) done(r Result) {
+	g.mu.Lock()
+	g.active--
+	g.finished++
+	if r.Alive {
+		g.window = append(g.window, r.Latency)
+	}
+	if g.finished >= max(g.limit, 5) {
+		g.adjust()
+	}
+	g.cond.Broadcast()
+	g.mu.Unlock()
+}
+
+// adjust resizes limit from the finished window. Called with mu held.
+func (g *workerGate) adjust() {
+	var median time.Duration
+	if len(g.window) > 0 {
+		sort.Slice(g.window, func(i, j int) bool { return g.window[i] < g.window[j] })
+		median = g.window[len(g.window)/2]
+		if g.baseline == 0 || median < g.baseline {
+			g.baseline = median
+		}
+	}
+	load, ok := loadAverage()
+	overloaded := ok && load > float64(runtime.NumCPU())
+	slow := median > 0 && median > 2*g.baseline
+
+	if overloaded || slow {
+		g.limit = max(1, g.limit*3/4)
+	} else {
+		g.limit = min(g.max, g.limit+max(1, g.limit/4))
+	}
+	g.window = g.window[:0]
+	g.finished = 0
+}
+
+// loadAverage returns the 1-minute load average where /proc/loadavg exists.
+func loadAverage() (float64, bool) {
+	data, err := os.ReadFile("/proc/loadavg")
+	if err != nil {
+		return 0, false
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 {
+		return 0, false
+	}
+	load, err := strconv.ParseFloat(fields[0], 64)
+	return load, err == nil
+}
@@ -0,0 +1,57 @@
+package checker
+
+import (
+	_ "embed"
+	"net/netip"
+	"strings"
+	"sync"
+)
+
+//go:embed cdn_ranges.txt
+var cdnRangesData string
+
+type cdnRange struct {
+	provider string
+	prefix   netip.Prefix
+}
+
+var (
+	cdnOnce   sync.Once
+	cdnRanges []cdnRange
+)
+
+// loadCDNRanges parses the embedded list once; malformed lines are skipped.
+func loadCDNRanges() {
+	for _, line := range strings.Split(cdnRangesData, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		provider, cidr, ok := strings.Cut(line, " ")
+		if !ok {
+			continue
+		}
+		prefix, err := netip.ParsePrefix(strings.TrimSpace(cidr))
+		if err != nil {
+			continue
+		}
+		cdnRanges = append(cdnRanges, cdnRange{provider: provider, prefix: prefix})
+	}
+}
+
+// CDNProvider returns the CDN whose published ranges contain ip ("cloudflare",
+// "fastly"), or "" when ip is not a known CDN address.
+func CDNProvider(ip string) string {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return ""
+	}
+	addr = addr.Unmap()
+	cdnOnce.Do(loadCDNRanges)
+	for _, r := range cdnRanges {
+		if r.prefix.Contains(addr) {
+			return r.provider
+		}
+	}
+	return ""
+}
@@ -2,13 +2,23 @@ package checker
 
 import (
 	"context"
+	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net"
 	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
+	"unicode"
 
 	"golang.org/x/net/proxy"
 	"vpn_checker/internal/parser"
@@ -17,18 +27,139 @@ import (
 
 // Result holds the outcome of checking a single proxy config
 type Result struct {
-	Index    int
-	Name     string
-	Protocol string
-	Server   string
-	Port     int
-	Alive    bool
-	Latency  time.Duration
-	ExitIP   string
-	Country  string
-	Error    string
+	Index       int
+	Name        string
+	Protocol    string
+	Server      string
+	Port        int
+	Fingerprint string // parser.Fingerprint of the config
+	Alive       bool
+	Latency     time.Duration
+	ConnectTime time.Duration // SOCKS dial through the tunnel (excludes TLS)
+	TLSTime     time.Duration // TLS handshake, zero for plain-HTTP geo lookups
+	TTFB        time.Duration // from connection ready to first response byte
+	TCPPing     time.Duration // direct TCP connect time to the server (-preping), 0 if unmeasured/unreachable
+	ExitIP      string
+	Country     string
+	IsCDN       bool // ExitIP is in a known CDN range (Cloudflare, Fastly), see CDNProvider
+
+	ExpectedRegion string // advertised exit country codes, see ExpectRegion
+	RegionMismatch bool   // alive, but Country is not in ExpectedRegion
+
+	DownloadMbps float64 // throughput through the tunnel (SpeedTest), 0 if unmeasured
+	UploadMbps   float64 // upload throughput (SpeedTestUpload), 0 if unmeasured
+
+	Error       string
+	FailPhase   string                  // where a dead check failed, one of FailPhases
+	Checks      map[string]CheckOutcome // per-target outcomes for ExtraTargets
+	KeepAlive   *CheckOutcome           // second probe after KeepAliveDelay, nil when disabled
+	Repeat      *RepeatStats            // attempts of a config checked several times (Repeats), nil otherwise
+	Score       float64                 // 0–100 quality rating, see Score
+	HasIPv6     bool                    // reached the IPv6-only endpoint through the tunnel (CheckIPv6)
+	Warning     string                  // caveats of an alive result: geo unverified (Lenient), legacy vmess downgraded
+	XrayLog     string                  // captured xray output of a failed check (only with xray.LogLevel above none)
+}
+
+// CheckOutcome is the result of probing one extra destination through the tunnel
+type CheckOutcome struct {
+	OK      bool
+	Status  int
+	Latency time.Duration
+	Error   string
+}
+
+// DumpDir, when set, receives a copy of every generated xray config as
+// <index>-<name>.json for inspection.
+var DumpDir string
+
+// Runner starts the xray backend for each check. Swap in xray.MockRunner to
+// exercise CheckConfig without the xray binary or network access.
+var Runner xrayrunner.Runner = xrayrunner.ExecRunner{}
+
+// ValidateConfigs runs each generated config through the runner's Validate
+// (xray run -test) first, so configs xray rejects fail with its error instead
+// of a "not ready" timeout.
+var ValidateConfigs bool
+
+// MaxXray caps how many xray processes run at once across all workers
+// (0 = no cap beyond the worker count). Must be set before checks start.
+var MaxXray int
+
+var (
+	xraySlotsOnce sync.Once
+	xraySlots     chan struct{}
+)
+
+// acquireXraySlot blocks until another xray process may start and returns the
+// function that frees the slot again.
+func acquireXraySlot() func() {
+	xraySlotsOnce.Do(func() {
+		if MaxXray > 0 {
+			xraySlots = make(chan struct{}, MaxXray)
+		}
+	})
+	if xraySlots == nil {
+		return func() {}
+	}
+	xraySlots <- struct{}{}
+	return func() { <-xraySlots }
+}
+
+// ConnectTimeout and GeoTimeout split the per-config budget into the tunnel
+// phase (dial + proxy handshake + TLS) and the wait for the geo API response.
+// Zero means the phase falls back to the overall timeout passed to CheckConfig.
+var (
+	ConnectTimeout time.Duration
+	GeoTimeout     time.Duration
+)
+
+// HeaderTimeout, when > 0, bounds the wait for the first response headers
+// once a request is written into the tunnel. Through xray's SOCKS inbound the
+// server handshake happens after the write, so this catches servers that
+// accept the tunnel and then never answer, well before GeoTimeout expires.
+var HeaderTimeout time.Duration
+
+// Lenient marks a config alive whenever the geo request completed an HTTP
+// round-trip through the tunnel, even if the geo response itself was unusable
+// (blocked, rate-limited, malformed). ExitIP/Country stay empty and Warning
+// explains why.
+var Lenient bool
+
+// CheckIPv6 additionally probes an IPv6-only endpoint through every alive
+// config and records the outcome in Result.HasIPv6. It never affects Alive.
+var CheckIPv6 bool
+
+// ipv6ProbeURL only has an AAAA record, so it answers only over IPv6 egress.
+const ipv6ProbeURL = "https://api6.ipify.org"
+
+// KeepAliveDelay, when > 0, holds the tunnel open after a successful geo
+// lookup and probes through it once more after the delay. Configs that fail
+// the second probe (servers that accept a connection and reset it shortly
+// after) are marked dead.
+var KeepAliveDelay time.Duration
+
+// keepAliveURL is on the geo API's host so the idle connection from the geo
+// lookup is reused when it survived.
+const keepAliveURL = "http://ip-api.com/json?fields=status"
+
+// Warmup sends one throwaway request over the geo API's host before the
+// measured geo lookup. It pays for the connection setup through the fresh
+// tunnel, so Latency reflects a warm connection (ConnectTime and TLSTime are
+// then near zero, the connection being reused).
+var Warmup bool
+
+// warmupURL is on the host of geoURL so its connection is the one reused.
+func warmupURL() string {
+	if geoDB != nil {
+		return ipOnlyURL
+	}
+	return keepAliveURL
 }
 
+// ExtraTargets are additional URLs probed through the tunnel once the geo
+// lookup succeeds. Their outcomes are informational and don't affect Alive.
+var ExtraTargets []string
+
 type ipAPIResponse struct {
 	Query       string `json:"query"`
 	CountryName string `json:"country"`
@@ -37,122 +168,732 @@ type ipAPIResponse struct {
 	Message     string `json:"message"`
 }
 
+// VmessStrict fails vmess configs with alterId > 0 right away. Such configs
+// ask for the legacy MD5-authenticated protocol, which xray no longer
+// implements; by default they are tried with AEAD (alterId 0) instead, which
+// servers accept unless they enforce legacy-only clients, and the result
+// carries a Warning.
+var VmessStrict bool
+
 // CheckConfig checks a single proxy config and returns a Result
 func CheckConfig(idx int, cfg parser.ProxyConfig, timeout time.Duration) Result {
-	result := Result{
-		Index:    idx,
-		Name:     cfg.GetName(),
-		Protocol: cfg.GetProtocol(),
-		Server:   cfg.GetServer(),
-		Port:     cfg.GetPort(),
-	}
+	return CheckConfigContext(context.Background(), idx, cfg, timeout)
+}
 
-	// Find a free local port for SOCKS5
-	socksPort, err := freePort()
-	if err != nil {
-		result.Error = fmt.Sprintf("no free port: %v", err)
+// CheckConfigContext is CheckConfig with cancellation: once ctx is done the
+// probes in flight fail and the tunnel is torn down.
+func CheckConfigContext(ctx context.Context, idx int, cfg parser.ProxyConfig, timeout time.Duration) (result Result) {
+	result = newResult(idx, cfg)
+	if !checkLegacyVmess(&result, cfg) {
 		return result
 	}
-
-	// Generate xray config
-	configJSON, err := xrayrunner.GenerateConfig(cfg, socksPort)
+	t, err := openTunnel(idx, cfg)
+	if t != nil {
+		defer t.close(&result)
+	}
 	if err != nil {
-		result.Error = fmt.Sprintf("config gen: %v", err)
+		result.Error = err.Error()
+		result.FailPhase = PhaseTunnelSetup
 		return result
 	}
+	probeTunnel(ctx, &result, t, timeout)
+	return result
+}
 
-	// Start xray
-	cmd, err := xrayrunner.Start(configJSON)
-	if err != nil {
-		result.Error = fmt.Sprintf("xray start: %v", err)
-		return result
+// checkLegacyVmess applies VmessStrict to vmess configs with alterId > 0:
+// it fails result and returns false in strict mode, otherwise it notes the
+// downgrade in result.Warning and returns true.
+func checkLegacyVmess(result *Result, cfg parser.ProxyConfig) bool {
+	v, ok := cfg.(*parser.VmessConfig)
+	if !ok || v.Aid <= 0 {
+		return true
 	}
-	defer xrayrunner.Stop(cmd)
+	if VmessStrict {
+		result.Error = fmt.Sprintf("vmess alterId %d: legacy protocol not supported by xray", v.Aid)
+		result.FailPhase = PhaseTunnelSetup
+		return false
+	}
+	result.addWarning(fmt.Sprintf("vmess alterId %d downgraded to AEAD (alterId 0)", v.Aid))
+	return true
+}
 
-	// Wait for xray SOCKS5 to become ready
-	if err := waitForPort("127.0.0.1", socksPort, 3*time.Second); err != nil {
-		result.Error = fmt.Sprintf("xray not ready: %v", err)
-		return result
+// addWarning appends w to the result's Warning, "; "-separated.
+func (r *Result) addWarning(w string) {
+	if r.Warning != "" {
+		r.Warning += "; "
 	}
+	r.Warning += w
+}
 
-	// Create SOCKS5 dialer
-	socksAddr := fmt.Sprintf("127.0.0.1:%d", socksPort)
-	dialer, err := proxy.SOCKS5("tcp", socksAddr, nil, proxy.Direct)
+func newResult(idx int, cfg parser.ProxyConfig) Result {
+	r := Result{
+		Index:       idx,
+		Name:        cfg.GetName(),
+		Protocol:    cfg.GetProtocol(),
+		Server:      cfg.GetServer(),
+		Port:        cfg.GetPort(),
+		Fingerprint: parser.Fingerprint(cfg),
+	}
+	if sni := xrayrunner.ImpliedSNI(cfg); sni != "" {
+		r.addWarning("no sni in config, using " + sni)
+	}
+	return r
+}
+
+// tunnel is an established path to the internet through one config: the
+// transport to probe with plus whatever has to be torn down afterwards.
+type tunnel struct {
+	transport *http.Transport
+	proc      xrayrunner.Process
+	release   func()
+
+	// serverAddr and serverName are set for xray tunnels with a tls/reality
+	// layer, to tell SNI filtering from a dead server (see detectBlockedSNI).
+	serverAddr string
+	serverName string
+}
+
+// close stops xray and frees its slot, attaching xray's output to result
+// when the check failed.
+//
+// Keep-alives stay on so the keepalive and -checks probes can reuse the geo
+// connection, which leaves that connection idle in the transport's pool once
+// probing is done. Every tunnel has its own transport that is never used
+// again, so without CloseIdleConnections each check would leak a socket until
+// the idle timeout, and runs of thousands of configs hit "too many open files".
+func (t *tunnel) close(result *Result) {
+	if t.transport != nil {
+		t.transport.CloseIdleConnections()
+	}
+	if t.proc != nil {
+		t.proc.Stop()
+		if !result.Alive {
+			result.XrayLog = t.proc.Output()
+			result.FailPhase = refineFailPhase(result.FailPhase, result.XrayLog)
+		}
+	}
+	if t.release != nil {
+		t.release()
+	}
+}
+
+// openTunnel sets up the transport for cfg, starting xray when the protocol
+// needs it. A non-nil tunnel may come back alongside an error (xray started
+// but never became ready); the caller must still close it.
+func openTunnel(idx int, cfg parser.ProxyConfig) (*tunnel, error) {
+	switch c := cfg.(type) {
+	case *parser.SocksConfig:
+		// Plain SOCKS5 proxies are dialed directly, no xray needed
+		var auth *proxy.Auth
+		if c.Username != "" || c.Password != "" {
+			auth = &proxy.Auth{User: c.Username, Password: c.Password}
+		}
+		dialer, err := proxy.SOCKS5("tcp", net.JoinHostPort(c.Server, strconv.Itoa(c.Port)), auth, proxy.Direct)
+		if err != nil {
+			return nil, fmt.Errorf("socks5 dialer: %v", err)
+		}
+		return &tunnel{transport: dialerTransport(dialer)}, nil
+	case *parser.HttpConfig:
+		transport := &http.Transport{
+			Proxy:       http.ProxyURL(httpProxyURL(c)),
+			DialContext: (&net.Dialer{}).DialContext,
+		}
+		if c.TLS && xrayrunner.Insecure {
+			// proxy-level TLS is ours rather than xray's, honour -insecure here too
+			transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+		}
+		return &tunnel{transport: transport}, nil
+	}
+
+	t := &tunnel{release: acquireXraySlot()}
+	var (
+		dial func(ctx context.Context, network, addr string) (net.Conn, error)
+		err  error
+	)
+	if TunMode {
+		dial, t.proc, err = startTun(idx, cfg.GetName(), cfg)
+	} else {
+		var dialer proxy.Dialer
+		dialer, t.proc, err = startTunnel(idx, cfg.GetName(), cfg)
+		if err == nil {
+			dial = socksDial(dialer)
+		}
+	}
 	if err != nil {
-		result.Error = fmt.Sprintf("socks5 dialer: %v", err)
-		return result
+		return t, err
 	}
+	// No Proxy: requests must leave through the tunnel's dialer, never through
+	// an HTTP_PROXY of the machine running the check.
+	t.transport = &http.Transport{DialContext: dial}
+	if xrayrunner.Front == nil { // through a front the server is not dialed from here
+		t.serverName = xrayrunner.ServerName(cfg)
+		t.serverAddr = net.JoinHostPort(cfg.GetServer(), strconv.Itoa(cfg.GetPort()))
+	}
+	return t, nil
+}
 
-	// Create HTTP client with SOCKS5 transport
-	transport := &http.Transport{
-		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
-			return dialer.Dial(network, addr)
-		},
+// probeTunnel runs the geo lookup and the optional extra probes through
+// transport and fills in result. Cancelling ctx aborts the requests in flight.
+func probeTunnel(ctx context.Context, result *Result, t *tunnel, timeout time.Duration) {
+	transport := t.transport
+	connectTimeout, geoTimeout := phaseTimeouts(timeout)
+	transport.DialContext = withDialTimeout(transport.DialContext, connectTimeout)
+	transport.TLSHandshakeTimeout = connectTimeout
+	transport.ResponseHeaderTimeout = geoTimeout
+	if HeaderTimeout > 0 && HeaderTimeout < geoTimeout {
+		transport.ResponseHeaderTimeout = HeaderTimeout
 	}
 	client := &http.Client{
 		Transport: transport,
 		Timeout:   timeout,
 	}
+	if ConnectTimeout > 0 || GeoTimeout > 0 {
+		client.Timeout = connectTimeout + geoTimeout
+	}
+
+	if Warmup {
+		// A failure is not reported here: the measured request below fails the
+		// same way and gets its phase classified.
+		probeTarget(ctx, client, warmupURL())
+	}
+
+	// Measure latency via HTTP GET, traced to split it into phases
+	var tlsStart, tlsDone, gotConn, wroteRequest, firstByte time.Time
+	trace := &httptrace.ClientTrace{
+		TLSHandshakeStart:    func() { tlsStart = time.Now() },
+		TLSHandshakeDone:     func(tls.ConnectionState, error) { tlsDone = time.Now() },
+		GotConn:              func(httptrace.GotConnInfo) { gotConn = time.Now() },
+		WroteRequest:         func(httptrace.WroteRequestInfo) { wroteRequest = time.Now() },
+		GotFirstResponseByte: func() { firstByte = time.Now() },
+	}
+	req, err := http.NewRequestWithContext(httptrace.WithClientTrace(ctx, trace),
+		http.MethodGet, geoURL(), nil)
+	if err != nil {
+		result.Error = fmt.Sprintf("http request: %v", err)
+		return
+	}
+
+	// Redirects are not followed: a redirected geo request means a captive
+	// portal or hijacking proxy, which readGeo reports as such.
+	geoClient := *client
+	geoClient.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
 
-	// Measure latency via HTTP GET
 	start := time.Now()
-	resp, err := client.Get("http://ip-api.com/json?fields=status,message,query,country,countryCode")
+	resp, err := geoClient.Do(req)
 	if err != nil {
 		result.Error = fmt.Sprintf("http get: %v", err)
-		return result
+		result.FailPhase = requestFailPhase(err, !tlsStart.IsZero(), !tlsDone.IsZero())
+		if stalledAfterWrite(err, wroteRequest, firstByte) {
+			detectBlockedSNI(result, t, connectTimeout)
+		}
+		return
 	}
 	defer resp.Body.Close()
 	result.Latency = time.Since(start)
+	if !tlsDone.IsZero() {
+		result.TLSTime = tlsDone.Sub(tlsStart)
+	}
+	if !gotConn.IsZero() {
+		result.ConnectTime = gotConn.Sub(start) - result.TLSTime
+		if !firstByte.IsZero() {
+			result.TTFB = firstByte.Sub(gotConn)
+		}
+	}
 
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		result.Error = fmt.Sprintf("read body: %v", err)
-		return result
+	readResp := readGeo
+	if geoDB != nil {
+		readResp = readExitIP
+	}
+	exitIP, country, geoErr := readResp(resp)
+	if geoErr != nil && len(GeoFallback) > 0 {
+		exitIP, country, geoErr = fallbackGeo(ctx, client, geoErr)
+	}
+	switch {
+	case geoErr == nil:
+		result.ExitIP = exitIP
+		result.IsCDN = CDNProvider(exitIP) != ""
+		result.Country = country
+	case Lenient:
+		result.addWarning("geo unverified: " + geoErr.Error())
+	default:
+		result.Error = geoErr.Error()
+		result.FailPhase = PhaseGeoLookup
+		return
+	}
+	if KeepAliveDelay > 0 {
+		select {
+		case <-time.After(KeepAliveDelay):
+		case <-ctx.Done():
+			result.Error = "keepalive: " + ctx.Err().Error()
+			result.FailPhase = PhaseKeepAlive
+			return
+		}
+		outcome := probeTarget(ctx, client, keepAliveURL)
+		result.KeepAlive = &outcome
+		if !outcome.OK {
+			result.Error = "keepalive: " + outcome.Error
+			if outcome.Error == "" {
+				result.Error = fmt.Sprintf("keepalive: HTTP %d", outcome.Status)
+			}
+			result.FailPhase = PhaseKeepAlive
+			return
+		}
+	}
+	result.Alive = true
+
+	if CheckIPv6 {
+		result.HasIPv6 = probeTarget(ctx, client, ipv6ProbeURL).OK
 	}
 
+	if SpeedTest {
+		runSpeedTests(ctx, result, transport, timeout)
+	}
+
+	if len(ExtraTargets) > 0 {
+		result.Checks = make(map[string]CheckOutcome, len(ExtraTargets))
+		for _, target := range ExtraTargets {
+			result.Checks[target] = probeTarget(ctx, client, target)
+		}
+	}
+	result.Score = Score(*result)
+}
+
+// readGeo decodes an ip-api response into exit IP and country code and
+// rejects non-success statuses. Redirects and HTML pages are reported as a
+// captive portal rather than as a JSON error.
+func readGeo(resp *http.Response) (string, string, error) {
+	if resp.StatusCode >= 300 && resp.StatusCode < 400 {
+		return "", "", fmt.Errorf("captive portal / unexpected response: HTTP %d redirect to %q",
+			resp.StatusCode, resp.Header.Get("Location"))
+	}
 	var apiResp ipAPIResponse
+	body, err := readBody(resp, 1<<20)
+	if err != nil {
+		return "", "", fmt.Errorf("read body: %v", err)
+	}
 	if err := json.Unmarshal(body, &apiResp); err != nil {
-		result.Error = fmt.Sprintf("json parse: %v", err)
-		return result
+		if ct := resp.Header.Get("Content-Type"); !strings.Contains(ct, "json") || looksLikeHTML(body) {
+			return "", "", fmt.Errorf("captive portal / unexpected response: HTTP %d, %s", resp.StatusCode, describeContentType(ct))
+		}
+		return "", "", fmt.Errorf("json parse: %v", err)
 	}
-
 	if apiResp.Status != "success" {
-		result.Error = fmt.Sprintf("ip-api: %s", apiResp.Message)
-		return result
+		return "", "", fmt.Errorf("ip-api: %s", apiResp.Message)
 	}
+	return apiResp.Query, apiResp.CountryCode, nil
+}
 
-	result.Alive = true
-	result.ExitIP = apiResp.Query
-	result.Country = apiResp.CountryCode
-	return result
+// looksLikeHTML reports whether body starts like an HTML document.
+func looksLikeHTML(body []byte) bool {
+	head := strings.ToLower(strings.TrimSpace(string(body[:min(len(body), 512)])))
+	return strings.HasPrefix(head, "<!doctype html") || strings.HasPrefix(head, "<html") || strings.HasPrefix(head, "<head")
+}
+
+// describeContentType names a response's content type for error messages.
+func describeContentType(ct string) string {
+	if ct == "" {
+		return "no content type"
+	}
+	return ct
+}
+
+// startTunnel launches xray for cfg and returns a SOCKS5 dialer into it. The
+// process is returned whenever it was started — even alongside an error — so
+// the caller can stop it and read its output. Errors are prefixed with the
+// phase that failed.
+func startTunnel(idx int, name string, cfg parser.ProxyConfig) (proxy.Dialer, xrayrunner.Process, error) {
+	// Find a free local port for SOCKS5
+	socksPort, err := freePort()
+	if err != nil {
+		return nil, nil, fmt.Errorf("no free port: %v", err)
+	}
+
+	// Generate xray config
+	configJSON, err := xrayrunner.GenerateConfig(cfg, socksPort)
+	if err != nil {
+		return nil, nil, fmt.Errorf("config gen: %v", err)
+	}
+
+	if DumpDir != "" {
+		if err := dumpConfig(idx, name, configJSON); err != nil {
+			return nil, nil, fmt.Errorf("dump config: %v", err)
+		}
+	}
+
+	if ValidateConfigs {
+		if err := Runner.Validate(configJSON); err != nil {
+			return nil, nil, fmt.Errorf("invalid config: %v", err)
+		}
+	}
+
+	// Start xray
+	proc, err := Runner.Start(configJSON)
+	if err != nil {
+		return nil, nil, fmt.Errorf("xray start: %v", err)
+	}
+
+	// Wait for xray SOCKS5 to become ready
+	if err := waitForPort(xrayrunner.ListenAddr, socksPort, 3*time.Second); err != nil {
+		return nil, proc, fmt.Errorf("xray not ready: %v", err)
+	}
+
+	// Create SOCKS5 dialer
+	socksAddr := net.JoinHostPort(xrayrunner.ListenAddr, strconv.Itoa(socksPort))
+	dialer, err := proxy.SOCKS5("tcp", socksAddr, nil, proxy.Direct)
+	if err != nil {
+		return nil, proc, fmt.Errorf("socks5 dialer: %v", err)
+	}
+	return dialer, proc, nil
+}
+
+// phaseTimeouts resolves ConnectTimeout/GeoTimeout against the overall timeout.
+func phaseTimeouts(timeout time.Duration) (connect, geo time.Duration) {
+	connect, geo = ConnectTimeout, GeoTimeout
+	if connect <= 0 {
+		connect = timeout
+	}
+	if geo <= 0 {
+		geo = timeout
+	}
+	return connect, geo
+}
+
+// withDialTimeout bounds every dial made through dial by d. For SOCKS dialers
+// this covers the proxy handshake, i.e. the tunnel's connect to the target.
+func withDialTimeout(dial func(ctx context.Context, network, addr string) (net.Conn, error), d time.Duration) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		ctx, cancel := context.WithTimeout(ctx, d)
+		defer cancel()
+		return dial(ctx, network, addr)
+	}
+}
+
+// dialerTransport wraps a SOCKS5 dialer into an HTTP transport
+func dialerTransport(dialer proxy.Dialer) *http.Transport {
+	return &http.Transport{DialContext: socksDial(dialer)}
+}
+
+// socksDial adapts a SOCKS5 dialer to a DialContext function, honouring the
+// context when the dialer supports it.
+func socksDial(dialer proxy.Dialer) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if cd, ok := dialer.(proxy.ContextDialer); ok {
+			return cd.DialContext(ctx, network, addr)
+		}
+		return dialer.Dial(network, addr)
+	}
+}
+
+// httpProxyURL builds the proxy URL (with credentials) for an HTTP(S) proxy config
+func httpProxyURL(c *parser.HttpConfig) *url.URL {
+	u := &url.URL{Scheme: "http", Host: net.JoinHostPort(c.Server, strconv.Itoa(c.Port))}
+	if c.TLS {
+		u.Scheme = "https"
+	}
+	if c.Username != "" || c.Password != "" {
+		u.User = url.UserPassword(c.Username, c.Password)
+	}
+	return u
+}
+
+// probeTarget issues a GET to target through client. Any response below 500
+// counts as reachable; the body is drained (up to 64KB) but not inspected.
+func probeTarget(ctx context.Context, client *http.Client, target string) CheckOutcome {
+	rawURL := target
+	if !strings.Contains(rawURL, "://") {
+		rawURL = "https://" + rawURL
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return CheckOutcome{Error: err.Error()}
+	}
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		return CheckOutcome{Error: err.Error()}
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	return CheckOutcome{
+		OK:      resp.StatusCode < 500,
+		Status:  resp.StatusCode,
+		Latency: time.Since(start),
+	}
 }
 
 // CheckAll runs CheckConfig concurrently with the given number of workers.
 // onResult is called (under a mutex) immediately after each config finishes — use it for live progress output.
+// With GeoWorkers set, tunnel setup and geo lookups run as two separate stages (see checkPipelined).
+// With StopAfterAlive set, only the configs actually checked are returned.
 func CheckAll(configs []parser.ProxyConfig, workers int, timeout time.Duration, onResult func(Result, int, int)) []Result {
+	return CheckAllContext(context.Background(), configs, workers, timeout, onResult)
+}
+
+// CheckAllContext is CheckAll stopping early when ctx is cancelled: pending
+// configs are not started, checks in flight are aborted, and only the
+// results finished before that are returned.
+func CheckAllContext(parent context.Context, configs []parser.ProxyConfig, workers int, timeout time.Duration, onResult func(Result, int, int)) []Result {
 	total := len(configs)
 	results := make([]Result, total)
-	jobs := make(chan int, total)
+	ctx, cancel := context.WithCancel(parent)
+	defer cancel()
 
 	var (
-		wg      sync.WaitGroup
-		mu      sync.Mutex
-		done    int
+		mu    sync.Mutex
+		done  int
+		alive int
 	)
+	finish := func(r Result) {
+		mu.Lock()
+		defer mu.Unlock()
+		if ctx.Err() != nil {
+			return // finished after StopAfterAlive was reached or ctx was cancelled
+		}
+		results[r.Index-1] = r
+		done++
+		if r.Alive {
+			alive++
+		}
+		if onResult != nil {
+			onResult(r, done, total)
+		}
+		if StopAfterAlive > 0 && alive >= StopAfterAlive {
+			cancel()
+		}
+	}
+
+	if GeoWorkers > 0 {
+		checkPipelined(ctx, configs, workers, timeout, finish)
+		return checkedResults(results)
+	}
 
+	jobs := make(chan int, total)
+	var wg sync.WaitGroup
+	if AutoWorkersMax > 0 {
+		// AutoWorkersMax goroutines, of which the gate lets a varying number run
+		gate := newWorkerGate(workers, AutoWorkersMax)
+		for i := 0; i < AutoWorkersMax; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for {
+					gate.acquire()
+					idx, ok := <-jobs
+					if !ok || ctx.Err() != nil {
+						gate.release()
+						if !ok {
+							return
+						}
+						continue
+					}
+					r := checkRuns(ctx, idx, configs[idx], timeout)
+					gate.done(r)
+					finish(r)
+				}
+			}()
+		}
+	} else {
+		for i := 0; i < workers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for idx := range jobs {
+					if ctx.Err() != nil {
+						continue // drain without checking
+					}
+					finish(checkRuns(ctx, idx, configs[idx], timeout))
+				}
+			}()
+		}
+	}
+
+	for _, i := range dispatchOrder(total) {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	return checkedResults(results)
+}
+
+// StopAfterAlive, when > 0, makes CheckAll stop once that many configs are
+// alive: pending configs are not dispatched and checks in flight are
+// cancelled and left out of the results.
+var StopAfterAlive int
+
+// Priorities, when set, holds one priority per config passed to CheckAll:
+// higher ones are dispatched first, equal ones in input order. Configs beyond
+// its length have the default priority 0. Results keep input order.
+var Priorities []int
+
+// dispatchOrder returns the indexes of n configs in the order CheckAll starts them.
+func dispatchOrder(n int) []int {
+	order := make([]int, n)
+	for i := range order {
+		order[i] = i
+	}
+	prio := func(i int) int {
+		if i < len(Priorities) {
+			return Priorities[i]
+		}
+		return 0
+	}
+	sort.SliceStable(order, func(a, b int) bool { return prio(order[a]) > prio(order[b]) })
+	return order
+}
+
+// checkedResults drops the slots of configs that were never checked
+// (StopAfterAlive reached or the context cancelled).
+func checkedResults(results []Result) []Result {
+	out := results[:0]
+	for _, r := range results {
+		if r.Index > 0 {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// GeoWorkers, when > 0, splits CheckAll into two stages: the regular workers
+// only bring tunnels up and hand them over a channel to GeoWorkers goroutines
+// that do the geo lookup and extra probes. GeoRate additionally caps the
+// lookups started per second across that pool (0 = unlimited), which keeps
+// ip-api's rate limit from failing otherwise healthy configs.
+var (
+	GeoWorkers int
+	GeoRate    float64
+)
+
+// readyTunnel is a tunnel waiting in the hand-off between the two stages.
+type readyTunnel struct {
+	result Result
+	tunnel *tunnel
+}
+
+// checkPipelined is CheckAll's two-stage variant. The hand-off channel holds
+// at most `workers` tunnels so setup can't run arbitrarily far ahead of the
+// lookups and pile up idle xray processes.
+func checkPipelined(ctx context.Context, configs []parser.ProxyConfig, workers int, timeout time.Duration, finish func(Result)) {
+	jobs := make(chan int, len(configs))
+	ready := make(chan readyTunnel, workers)
+
+	var limit <-chan time.Time
+	if GeoRate > 0 {
+		ticker := time.NewTicker(time.Duration(float64(time.Second) / GeoRate))
+		defer ticker.Stop()
+		limit = ticker.C
+	}
+
+	var setup sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		setup.Add(1)
+		go func() {
+			defer setup.Done()
+			for idx := range jobs {
+				if ctx.Err() != nil {
+					continue // drain without checking
+				}
+				r := newResult(idx+1, configs[idx])
+				if !checkLegacyVmess(&r, configs[idx]) {
+					finish(r)
+					continue
+				}
+				t, err := openTunnel(idx+1, configs[idx])
+				if err != nil {
+					r.Error = err.Error()
+					r.FailPhase = PhaseTunnelSetup
+					if t != nil {
+						t.close(&r)
+					}
+					finish(r)
+					continue
+				}
+				ready <- readyTunnel{result: r, tunnel: t}
+			}
+		}()
+	}
+
+	var lookups sync.WaitGroup
+	for i := 0; i < GeoWorkers; i++ {
+		lookups.Add(1)
+		go func() {
+			defer lookups.Done()
+			for rt := range ready {
+				if limit != nil {
+					<-limit
+				}
+				probeTunnel(ctx, &rt.result, rt.tunnel, timeout)
+				rt.tunnel.close(&rt.result)
+				finish(rt.result)
+			}
+		}()
+	}
+
+	for _, i := range dispatchOrder(len(configs)) {
+		jobs <- i
+	}
+	close(jobs)
+	setup.Wait()
+	close(ready)
+	lookups.Wait()
+}
+
+// dumpConfig writes configJSON to DumpDir/<idx>-<sanitized name>.json
+func dumpConfig(idx int, name string, configJSON []byte) error {
+	if err := os.MkdirAll(DumpDir, 0o755); err != nil {
+		return err
+	}
+	file := fmt.Sprintf("%d-%s.json", idx, SanitizeFilename(name))
+	return os.WriteFile(filepath.Join(DumpDir, file), configJSON, 0o644)
+}
+
+// SanitizeFilename keeps letters, digits, '-', '_' and '.', replacing
+// everything else with '_', and caps the length at 60 runes.
+func SanitizeFilename(name string) string {
+	var b strings.Builder
+	n := 0
+	for _, r := range name {
+		if n >= 60 {
+			break
+		}
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '-' || r == '_' || r == '.' {
+			b.WriteRune(r)
+		} else {
+			b.WriteRune('_')
+		}
+		n++
+	}
+	if b.Len() == 0 {
+		return "config"
+	}
+	return b.String()
+}
+
+// TCPPing measures how long a direct TCP connect to host:port takes.
+func TCPPing(host string, port int, timeout time.Duration) (time.Duration, error) {
+	start := time.Now()
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(host, strconv.Itoa(port)), timeout)
+	if err != nil {
+		return 0, err
+	}
+	conn.Close()
+	return time.Since(start), nil
+}
+
+// PingAll TCP-pings every config's server concurrently. Unreachable servers get 0.
+func PingAll(configs []parser.ProxyConfig, workers int, timeout time.Duration) []time.Duration {
+	pings := make([]time.Duration, len(configs))
+	jobs := make(chan int, len(configs))
+
+	var wg sync.WaitGroup
 	for i := 0; i < workers; i++ {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
 			for idx := range jobs {
-				r := CheckConfig(idx+1, configs[idx], timeout)
-				mu.Lock()
-				results[idx] = r
-				done++
-				if onResult != nil {
-					onResult(r, done, total)
+				if d, err := TCPPing(configs[idx].GetServer(), configs[idx].GetPort(), timeout); err == nil {
+					pings[idx] = d
 				}
-				mu.Unlock()
 			}
 		}()
 	}
@@ -163,12 +904,15 @@ func CheckAll(configs []parser.ProxyConfig, workers int, timeout time.Duration,
 	close(jobs)
 	wg.Wait()
 
-	return results
+	return pings
 }
 
-// freePort finds an available TCP port on localhost
+// freePort finds an available TCP port on the inbound listen address
 func freePort() (int, error) {
-	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if PortRangeMin > 0 {
+		return freePortInRange(PortRangeMin, PortRangeMax)
+	}
+	ln, err := net.Listen("tcp", net.JoinHostPort(xrayrunner.ListenAddr, "0"))
 	if err != nil {
 		return 0, err
 	}
@@ -177,9 +921,60 @@ func freePort() (int, error) {
 	return port, nil
 }
 
+// PortRangeMin and PortRangeMax restrict the local SOCKS ports handed to xray
+// to [min, max] for hosts whose firewall only allows certain local ports.
+// Zero means any port from the OS ephemeral range.
+var (
+	PortRangeMin int
+	PortRangeMax int
+)
+
+// portCursor rotates the starting point within the range so concurrent
+// workers don't all race for the same first free port.
+var portCursor atomic.Uint32
+
+// freePortInRange tries every port in [lo, hi] once, starting after the port
+// handed out last, and returns the first that binds.
+func freePortInRange(lo, hi int) (int, error) {
+	size := hi - lo + 1
+	start := int(portCursor.Add(1))
+	for i := 0; i < size; i++ {
+		port := lo + (start+i)%size
+		ln, err := net.Listen("tcp", net.JoinHostPort(xrayrunner.ListenAddr, strconv.Itoa(port)))
+		if err != nil {
+			continue
+		}
+		ln.Close()
+		portCursor.Store(uint32(start + i))
+		return port, nil
+	}
+	return 0, fmt.Errorf("no free port in range %d-%d", lo, hi)
+}
+
+// ParsePortRange parses "lo-hi" (e.g. "20000-21000"). An empty string means no range.
+func ParsePortRange(s string) (lo, hi int, err error) {
+	if s == "" {
+		return 0, 0, nil
+	}
+	a, b, ok := strings.Cut(s, "-")
+	if !ok {
+		return 0, 0, fmt.Errorf("invalid port range %q: want lo-hi", s)
+	}
+	if lo, err = strconv.Atoi(strings.TrimSpace(a)); err != nil {
+		return 0, 0, fmt.Errorf("invalid port range %q: %w", s, err)
+	}
+	if hi, err = strconv.Atoi(strings.TrimSpace(b)); err != nil {
+		return 0, 0, fmt.Errorf("invalid port range %q: %w", s, err)
+	}
+	if lo < 1 || hi > 65535 || lo > hi {
+		return 0, 0, fmt.Errorf("invalid port range %q: want 1 <= lo <= hi <= 65535", s)
+	}
+	return lo, hi, nil
+}
+
 // waitForPort polls until the given TCP address is accepting connections or timeout
 func waitForPort(host string, port int, timeout time.Duration) error {
-	addr := fmt.Sprintf("%s:%d", host, port)
+	addr := net.JoinHostPort(host, strconv.Itoa(port))
 	deadline := time.Now().Add(timeout)
 	for time.Now().Before(deadline) {
 		conn, err := net.DialTimeout("tcp", addr, 200*time.Millisecond)
@@ -0,0 +1,224 @@
+package checker
+
+import (
+	"encoding/base64"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"vpn_checker/internal/parser"
+	xrayrunner "vpn_checker/internal/xray"
+)
+
+const testVless = "vless://11111111-2222-3333-4444-555555555555@vless.example.com:443?type=ws&security=tls&sni=cdn.example.com&path=%2Fws#mock"
+
+// useMockRunner makes every tunnel a MockRunner that sends each CONNECT to
+// dial, and returns the addresses the checker asked the tunnel for.
+func useMockRunner(t *testing.T, dial func(network, addr string) (net.Conn, error)) func() []string {
+	t.Helper()
+	var (
+		mu    sync.Mutex
+		addrs []string
+	)
+	prev := Runner
+	Runner = xrayrunner.MockRunner{Dial: func(network, addr string) (net.Conn, error) {
+		mu.Lock()
+		addrs = append(addrs, addr)
+		mu.Unlock()
+		return dial(network, addr)
+	}}
+	t.Cleanup(func() { Runner = prev })
+	return func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), addrs...)
+	}
+}
+
+func mustParse(t *testing.T, uri string) parser.ProxyConfig {
+	t.Helper()
+	cfg, err := parser.ParseLine(uri)
+	if err != nil {
+		t.Fatalf("parse %s: %v", uri, err)
+	}
+	return cfg
+}
+
+func TestCheckConfigMockAlive(t *testing.T) {
+	geo := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"status":"success","query":"203.0.113.7","country":"Germany","countryCode":"DE"}`))
+	}))
+	defer geo.Close()
+	dialed := useMockRunner(t, func(network, _ string) (net.Conn, error) {
+		return net.Dial(network, geo.Listener.Addr().String())
+	})
+
+	r := CheckConfig(1, mustParse(t, testVless), 5*time.Second)
+	if !r.Alive {
+		t.Fatalf("config not alive: %s (phase %s)", r.Error, r.FailPhase)
+	}
+	if r.ExitIP != "203.0.113.7" || r.Country != "DE" {
+		t.Errorf("exit = %s %s, want 203.0.113.7 DE", r.ExitIP, r.Country)
+	}
+	if r.Latency <= 0 {
+		t.Errorf("latency = %v, want > 0", r.Latency)
+	}
+	if addrs := dialed(); len(addrs) == 0 || addrs[0] != "ip-api.com:80" {
+		t.Errorf("tunnel dialed %v, want the geo API ip-api.com:80 first", addrs)
+	}
+}
+
+func TestCheckConfigMockGeoFailure(t *testing.T) {
+	geo := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"status":"fail","message":"quota exceeded"}`))
+	}))
+	defer geo.Close()
+	useMockRunner(t, func(network, _ string) (net.Conn, error) {
+		return net.Dial(network, geo.Listener.Addr().String())
+	})
+
+	r := CheckConfig(1, mustParse(t, testVless), 5*time.Second)
+	if r.Alive {
+		t.Fatal("config alive despite a failed geo lookup")
+	}
+	if r.FailPhase != PhaseGeoLookup || !strings.Contains(r.Error, "quota exceeded") {
+		t.Errorf("got phase %q error %q, want %s with the API message", r.FailPhase, r.Error, PhaseGeoLookup)
+	}
+}
+
+func TestCheckConfigMockUnreachable(t *testing.T) {
+	useMockRunner(t, func(string, string) (net.Conn, error) {
+		return nil, errors.New("connection refused")
+	})
+
+	r := CheckConfig(1, mustParse(t, testVless), 5*time.Second)
+	if r.Alive {
+		t.Fatal("config alive although the tunnel refuses every connection")
+	}
+	if r.Error == "" || r.FailPhase == "" {
+		t.Errorf("dead result without error/phase: %+v", r)
+	}
+}
+
+func TestCheckLegacyVmess(t *testing.T) {
+	body := `{"v":"2","ps":"aid64","add":"vmess.example.com","port":"443","id":"11111111-2222-3333-4444-555555555555","aid":"64","net":"tcp"}`
+	cfg := mustParse(t, "vmess://"+base64.StdEncoding.EncodeToString([]byte(body)))
+
+	prev := VmessStrict
+	t.Cleanup(func() { VmessStrict = prev })
+
+	VmessStrict = false
+	r := newResult(1, cfg)
+	if !checkLegacyVmess(&r, cfg) {
+		t.Fatalf("lenient mode refused aid=64: %s", r.Error)
+	}
+	if !strings.Contains(r.Warning, "alterId 64 downgraded to AEAD") {
+		t.Errorf("warning = %q, want the AEAD downgrade noted", r.Warning)
+	}
+
+	VmessStrict = true
+	r = newResult(1, cfg)
+	if checkLegacyVmess(&r, cfg) {
+		t.Fatal("strict mode accepted aid=64")
+	}
+	if r.FailPhase != PhaseTunnelSetup || !strings.Contains(r.Error, "alterId 64") {
+		t.Errorf("got phase %q error %q, want %s with the alterId", r.FailPhase, r.Error, PhaseTunnelSetup)
+	}
+
+	// A strict run must not start a tunnel for it at all.
+	useMockRunner(t, func(string, string) (net.Conn, error) {
+		t.Error("tunnel dialed for a config strict mode rejects")
+		return nil, errors.New("unexpected dial")
+	})
+	if r := CheckConfig(1, cfg, time.Second); r.Alive || r.FailPhase != PhaseTunnelSetup {
+		t.Errorf("CheckConfig = alive %v phase %q, want dead in %s", r.Alive, r.FailPhase, PhaseTunnelSetup)
+	}
+}
+
+// TestTunnelIgnoresEnvProxy checks that probes leave through the tunnel even
+// when the machine has an HTTP_PROXY: the geo API must be reached via the
+// SOCKS inbound, never via the proxy. net/http reads the proxy variables once
+// per process, so this must stay the only test in the package that sets them.
+func TestTunnelIgnoresEnvProxy(t *testing.T) {
+	var proxyHits int
+	var mu sync.Mutex
+	envProxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		proxyHits++
+		mu.Unlock()
+		http.Error(w, "request leaked to HTTP_PROXY", http.StatusBadGateway)
+	}))
+	defer envProxy.Close()
+	t.Setenv("HTTP_PROXY", envProxy.URL)
+	t.Setenv("http_proxy", envProxy.URL)
+	t.Setenv("NO_PROXY", "")
+	t.Setenv("no_proxy", "")
+
+	geo := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"status":"success","query":"203.0.113.7","countryCode":"DE"}`))
+	}))
+	defer geo.Close()
+	dialed := useMockRunner(t, func(network, _ string) (net.Conn, error) {
+		return net.Dial(network, geo.Listener.Addr().String())
+	})
+
+	r := CheckConfig(1, mustParse(t, testVless), 5*time.Second)
+	if !r.Alive {
+		t.Fatalf("config not alive: %s", r.Error)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if proxyHits != 0 {
+		t.Errorf("HTTP_PROXY received %d requests meant for the tunnel", proxyHits)
+	}
+	// With a Proxy set, the transport would dial the proxy's address through
+	// the tunnel instead of the geo API's.
+	addrs := dialed()
+	if len(addrs) == 0 {
+		t.Error("nothing went through the tunnel")
+	}
+	for _, addr := range addrs {
+		if addr != "ip-api.com:80" {
+			t.Errorf("tunnel asked to connect to %s, want only the geo API ip-api.com:80", addr)
+		}
+	}
+}
+
+func TestNewResultWarnsImpliedSNI(t *testing.T) {
+	r := newResult(1, mustParse(t, "vless://11111111-2222-3333-4444-555555555555@reality.example.com:443?security=reality&pbk=PUBLICKEY&sid=abcd#r"))
+	if want := "no sni in config, using reality.example.com"; r.Warning != want {
+		t.Errorf("warning = %q, want %q", r.Warning, want)
+	}
+	r = newResult(1, mustParse(t, testVless))
+	if r.Warning != "" {
+		t.Errorf("warning %q for a config with sni", r.Warning)
+	}
+}
+
+func TestCheckConfigMockPlaintextWS(t *testing.T) {
+	geo := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"status":"success","query":"203.0.113.9","countryCode":"NL"}`))
+	}))
+	defer geo.Close()
+	useMockRunner(t, func(network, _ string) (net.Conn, error) {
+		return net.Dial(network, geo.Listener.Addr().String())
+	})
+
+	cfg := mustParse(t, "vless://11111111-2222-3333-4444-555555555555@vless.example.com:80?type=ws&security=none&path=%2Fplain#plain")
+	r := CheckConfig(1, cfg, 5*time.Second)
+	if !r.Alive || r.Country != "NL" {
+		t.Fatalf("plaintext ws config: alive %v country %q error %q", r.Alive, r.Country, r.Error)
+	}
+	if r.Warning != "" {
+		t.Errorf("unexpected warning for a plaintext config: %q", r.Warning)
+	}
+}
@@ -0,0 +1,50 @@
+package checker
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"vpn_checker/internal/parser"
+	xrayrunner "vpn_checker/internal/xray"
+)
+
+// LookupDirect queries the geo API without any tunnel and returns this
+// machine's own exit IP and country.
+func LookupDirect(timeout time.Duration) (string, string, error) {
+	client := &http.Client{Timeout: timeout}
+	resp, err := client.Get("http://ip-api.com/json?fields=status,message,query,country,countryCode")
+	if err != nil {
+		return "", "", err
+	}
+	defer resp.Body.Close()
+	return readGeo(resp)
+}
+
+// CheckDirect runs a regular check through an xray whose only outbound goes
+// straight out. Success means xray starts, the local SOCKS inbound answers and
+// the geo lookup works through it, so failures of real configs are theirs.
+func CheckDirect(timeout time.Duration) Result {
+	result := Result{Index: 1, Name: "direct", Protocol: "freedom"}
+	port, err := freePort()
+	if err != nil {
+		result.Error = fmt.Sprintf("no free port: %v", err)
+		return result
+	}
+	configJSON, err := xrayrunner.GenerateDirectConfig(port)
+	if err != nil {
+		result.Error = fmt.Sprintf("config gen: %v", err)
+		return result
+	}
+	proc, err := Runner.Start(configJSON)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	defer proc.Stop()
+	if err := waitForPort(xrayrunner.ListenAddr, port, 5*time.Second); err != nil {
+		result.Error = fmt.Sprintf("xray socks inbound: %v", err)
+		return result
+	}
+	return CheckConfig(1, &parser.SocksConfig{Name: "direct", Server: xrayrunner.ListenAddr, Port: port}, timeout)
+}
@@ -0,0 +1,150 @@
+package checker
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// GeoFallback lists providers (see GeoProviders) tried in order, over the
+// same tunnel, when ip-api answers but its response is unusable — typically
+// rate limiting on large runs. Transport errors never fall back: those mean
+// the tunnel itself is broken.
+var GeoFallback []string
+
+// geoProvider is a secondary exit-IP/country lookup endpoint.
+type geoProvider struct {
+	url   string
+	parse func(body []byte) (ip, country string, err error)
+}
+
+// geoProviders are the fallbacks accepted in GeoFallback, keyed by name.
+var geoProviders = map[string]geoProvider{
+	"ipinfo": {
+		url: "https://ipinfo.io/json",
+		parse: func(body []byte) (string, string, error) {
+			var r struct {
+				IP      string `json:"ip"`
+				Country string `json:"country"`
+			}
+			if err := json.Unmarshal(body, &r); err != nil {
+				return "", "", fmt.Errorf("json parse: %v", err)
+			}
+			return r.IP, r.Country, nil
+		},
+	},
+	"ipwho": {
+		url: "https://ipwho.is/",
+		parse: func(body []byte) (string, string, error) {
+			var r struct {
+				Success     bool   `json:"success"`
+				Message     string `json:"message"`
+				IP          string `json:"ip"`
+				CountryCode string `json:"country_code"`
+			}
+			if err := json.Unmarshal(body, &r); err != nil {
+				return "", "", fmt.Errorf("json parse: %v", err)
+			}
+			if !r.Success {
+				return "", "", fmt.Errorf("%s", r.Message)
+			}
+			return r.IP, r.CountryCode, nil
+		},
+	},
+	"ifconfig": {
+		url: "https://ifconfig.co/json",
+		parse: func(body []byte) (string, string, error) {
+			var r struct {
+				IP         string `json:"ip"`
+				CountryISO string `json:"country_iso"`
+			}
+			if err := json.Unmarshal(body, &r); err != nil {
+				return "", "", fmt.Errorf("json parse: %v", err)
+			}
+			return r.IP, r.CountryISO, nil
+		},
+	},
+}
+
+// GeoProviders returns the names accepted in GeoFallback.
+func GeoProviders() []string {
+	return []string{"ipinfo", "ipwho", "ifconfig"}
+}
+
+// fallbackGeo tries each GeoFallback provider through client until one
+// yields an exit IP. primaryErr is kept in the error if all of them fail.
+func fallbackGeo(ctx context.Context, client *http.Client, primaryErr error) (string, string, error) {
+	errs := []string{primaryErr.Error()}
+	for _, name := range GeoFallback {
+		p, ok := geoProviders[name]
+		if !ok {
+			continue
+		}
+		ip, country, err := lookupGeo(ctx, client, p)
+		if err == nil {
+			return ip, country, nil
+		}
+		errs = append(errs, name+": "+err.Error())
+	}
+	return "", "", fmt.Errorf("%s", strings.Join(errs, "; "))
+}
+
+func lookupGeo(ctx context.Context, client *http.Client, p geoProvider) (string, string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.url, nil)
+	if err != nil {
+		return "", "", err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", "", fmt.Errorf("status %d", resp.StatusCode)
+	}
+	body, err := readBody(resp, 64<<10)
+	if err != nil {
+		return "", "", fmt.Errorf("read body: %v", err)
+	}
+	ip, country, err := p.parse(body)
+	if err == nil && ip == "" {
+		err = fmt.Errorf("no ip in response")
+	}
+	return ip, country, err
+}
+
+// readBody reads up to limit bytes of resp's body, decompressing it when the
+// server sent Content-Encoding gzip or deflate on its own. (The transport only
+// decodes transparently when it asked for gzip itself, and never deflate.)
+func readBody(resp *http.Response, limit int64) ([]byte, error) {
+	var r io.Reader = resp.Body
+	switch strings.ToLower(resp.Header.Get("Content-Encoding")) {
+	case "gzip", "x-gzip":
+		gz, err := gzip.NewReader(resp.Body)
+		if err != nil {
+			return nil, fmt.Errorf("gzip: %v", err)
+		}
+		defer gz.Close()
+		r = gz
+	case "deflate":
+		raw, err := io.ReadAll(io.LimitReader(resp.Body, limit))
+		if err != nil {
+			return nil, err
+		}
+		// "deflate" is meant to be zlib-wrapped, but raw DEFLATE is common too.
+		if zr, err := zlib.NewReader(bytes.NewReader(raw)); err == nil {
+			defer zr.Close()
+			r = zr
+		} else {
+			r = flate.NewReader(bytes.NewReader(raw))
+		}
+	}
+	return io.ReadAll(io.LimitReader(r, limit))
+}
@@ -0,0 +1,77 @@
+package checker
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// ipOnlyURL answers with the caller's IP as plain text. With a local geo
+// database it replaces ip-api: the tunnel only has to reveal the exit IP.
+const ipOnlyURL = "http://api.ipify.org"
+
+// geoDB resolves exit IPs to countries offline when set (LoadGeoDB).
+var geoDB *maxminddb.Reader
+
+// LoadGeoDB opens a MaxMind GeoLite2/GeoIP2 Country or City database. From
+// then on checks ask the tunnel only for the exit IP and look the country up
+// locally, so runs no longer depend on ip-api and its rate limit.
+func LoadGeoDB(path string) error {
+	db, err := maxminddb.Open(path)
+	if err != nil {
+		return err
+	}
+	geoDB = db
+	return nil
+}
+
+// geoRecord is the part of a GeoIP2 record the checker needs.
+type geoRecord struct {
+	Country struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+	RegisteredCountry struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"registered_country"`
+}
+
+// geoURL is the endpoint of the geo request made through each tunnel.
+func geoURL() string {
+	if geoDB != nil {
+		return ipOnlyURL
+	}
+	return "http://ip-api.com/json?fields=status,message,query,country,countryCode"
+}
+
+// readExitIP reads a plain-text "what's my IP" response and resolves its
+// country in geoDB. An IP missing from the database leaves the country empty.
+func readExitIP(resp *http.Response) (string, string, error) {
+	if resp.StatusCode >= 300 && resp.StatusCode < 400 {
+		return "", "", fmt.Errorf("captive portal / unexpected response: HTTP %d redirect to %q",
+			resp.StatusCode, resp.Header.Get("Location"))
+	}
+	body, err := readBody(resp, 1<<10)
+	if err != nil {
+		return "", "", fmt.Errorf("read body: %v", err)
+	}
+	ip := net.ParseIP(strings.TrimSpace(string(body)))
+	if ip == nil {
+		if resp.StatusCode != http.StatusOK || looksLikeHTML(body) {
+			return "", "", fmt.Errorf("captive portal / unexpected response: HTTP %d, %s",
+				resp.StatusCode, describeContentType(resp.Header.Get("Content-Type")))
+		}
+		return "", "", fmt.Errorf("no ip in response")
+	}
+	var rec geoRecord
+	if err := geoDB.Lookup(ip, &rec); err != nil {
+		return "", "", fmt.Errorf("mmdb lookup: %v", err)
+	}
+	country := rec.Country.ISOCode
+	if country == "" {
+		country = rec.RegisteredCountry.ISOCode
+	}
+	return ip.String(), country, nil
+}
@@ -0,0 +1,84 @@
+package checker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// Failure phases recorded in Result.FailPhase, in the order a check passes them.
+const (
+	PhaseTunnelSetup  = "tunnel-setup"  // port, config generation, xray start/ready
+	PhaseDNS          = "dns"           // resolving the server (or geo API) name
+	PhaseTCPConnect   = "tcp-connect"   // reaching the server
+	PhaseTLSHandshake = "tls-handshake" // TLS/reality handshake with the server
+	PhaseBlockedSNI   = "blocked-sni"   // server reachable over TCP, the TLS tunnel stalled silently
+	PhaseGeoLookup    = "geo-lookup"    // tunnel worked, the geo response was unusable
+	PhaseKeepAlive    = "keepalive"     // the tunnel dropped before the KeepAliveDelay probe
+)
+
+// FailPhases lists the phases in check order, for summaries.
+var FailPhases = []string{PhaseTunnelSetup, PhaseDNS, PhaseTCPConnect, PhaseTLSHandshake, PhaseBlockedSNI, PhaseGeoLookup, PhaseKeepAlive}
+
+// requestFailPhase classifies an error of the geo request. Through a SOCKS
+// tunnel xray accepts the CONNECT before dialing the server, so most upstream
+// failures surface as an EOF or timeout after the local connection succeeded;
+// those count as tcp-connect until refineFailPhase learns more from xray's log.
+func requestFailPhase(err error, tlsStarted, tlsDone bool) string {
+	var dnsErr *net.DNSError
+	msg := strings.ToLower(err.Error())
+	switch {
+	case errors.As(err, &dnsErr), strings.Contains(msg, "no such host"):
+		return PhaseDNS
+	case tlsStarted && !tlsDone, strings.Contains(msg, "tls:"), strings.Contains(msg, "handshake"):
+		return PhaseTLSHandshake
+	}
+	return PhaseTCPConnect
+}
+
+// refineFailPhase looks for a more specific cause in xray's captured output
+// (only present with xray.LogLevel above none). It returns phase unchanged
+// when the log says nothing recognisable.
+func refineFailPhase(phase, xrayLog string) string {
+	if phase != PhaseTCPConnect || xrayLog == "" {
+		return phase
+	}
+	log := strings.ToLower(xrayLog)
+	switch {
+	case strings.Contains(log, "lookup "), strings.Contains(log, "no such host"):
+		return PhaseDNS
+	case strings.Contains(log, "tls"), strings.Contains(log, "reality"), strings.Contains(log, "handshake"):
+		return PhaseTLSHandshake
+	}
+	return phase
+}
+
+// stalledAfterWrite reports whether the geo request went into the tunnel and
+// then timed out without a single response byte. Through xray's SOCKS inbound
+// a server that is down usually shows up as a prompt EOF instead, because
+// xray drops the client connection once its own dial fails.
+func stalledAfterWrite(err error, wroteRequest, firstByte time.Time) bool {
+	var netErr net.Error
+	timedOut := errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout())
+	return timedOut && !wroteRequest.IsZero() && firstByte.IsZero()
+}
+
+// detectBlockedSNI relabels a stalled check of a tls/reality config as
+// blocked-sni when the server still accepts a direct TCP connection: the
+// server is up, but the handshake carrying its SNI never completes — the
+// signature of DPI dropping connections by SNI.
+func detectBlockedSNI(result *Result, t *tunnel, dialTimeout time.Duration) {
+	if t.serverName == "" || t.serverAddr == "" {
+		return
+	}
+	conn, err := net.DialTimeout("tcp", t.serverAddr, dialTimeout)
+	if err != nil {
+		return // server unreachable: a dead server, not filtering
+	}
+	conn.Close()
+	result.FailPhase = PhaseBlockedSNI
+	result.Error += fmt.Sprintf(" (server reachable over TCP, TLS with SNI %q stalled: likely SNI filtering)", t.serverName)
+}
@@ -0,0 +1,24 @@
+package checker
+
+import "strings"
+
+// ExpectRegion records the country codes r is expected to exit in, as a
+// comma-separated list (e.g. "DE" or "DE,NL"), and flags RegionMismatch when
+// an alive result with a known country exits anywhere else.
+func (r *Result) ExpectRegion(expected string) {
+	expected = strings.ToUpper(strings.ReplaceAll(expected, " ", ""))
+	if expected == "" {
+		return
+	}
+	r.ExpectedRegion = expected
+	r.RegionMismatch = false
+	if !r.Alive || r.Country == "" {
+		return
+	}
+	for _, code := range strings.Split(expected, ",") {
+		if strings.EqualFold(code, r.Country) {
+			return
+		}
+	}
+	r.RegionMismatch = true
+}
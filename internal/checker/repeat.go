@@ -0,0 +1,78 @@
+package checker
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"vpn_checker/internal/parser"
+)
+
+// Repeats, when set, holds how many times CheckAll checks each config (load
+// testing). Configs beyond its length, or with a count below 2, are checked
+// once as usual.
+var Repeats []int
+
+// RepeatStats aggregates the attempts of a config checked more than once.
+// Latencies are over the successful attempts only.
+type RepeatStats struct {
+	Runs          int
+	OK            int
+	LatencyMin    time.Duration
+	LatencyMedian time.Duration
+	LatencyP90    time.Duration
+	LatencyMax    time.Duration
+}
+
+// SuccessRate is the share of attempts that came back alive, in [0, 1].
+func (s RepeatStats) SuccessRate() float64 {
+	if s.Runs == 0 {
+		return 0
+	}
+	return float64(s.OK) / float64(s.Runs)
+}
+
+// checkRuns checks the config at idx as many times as Repeats asks.
+func checkRuns(ctx context.Context, idx int, cfg parser.ProxyConfig, timeout time.Duration) Result {
+	n := 1
+	if idx < len(Repeats) {
+		n = Repeats[idx]
+	}
+	if n < 2 {
+		return CheckConfigContext(ctx, idx+1, cfg, timeout)
+	}
+	return checkRepeated(ctx, idx+1, cfg, timeout, n)
+}
+
+// checkRepeated checks cfg n times in a row. The result is the last alive
+// attempt (or the last attempt when none was) with Latency replaced by the
+// median and the distribution in Repeat; it is alive if any attempt was.
+func checkRepeated(ctx context.Context, idx int, cfg parser.ProxyConfig, timeout time.Duration, n int) Result {
+	var (
+		result    Result
+		stats     RepeatStats
+		latencies []time.Duration
+	)
+	for i := 0; i < n && ctx.Err() == nil; i++ {
+		r := CheckConfigContext(ctx, idx, cfg, timeout)
+		stats.Runs++
+		if r.Alive {
+			stats.OK++
+			latencies = append(latencies, r.Latency)
+		}
+		if r.Alive || !result.Alive {
+			result = r
+		}
+	}
+	if len(latencies) > 0 {
+		sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+		stats.LatencyMin = latencies[0]
+		stats.LatencyMedian = latencies[len(latencies)/2]
+		stats.LatencyP90 = latencies[(len(latencies)*9)/10]
+		stats.LatencyMax = latencies[len(latencies)-1]
+		result.Latency = stats.LatencyMedian
+	}
+	result.Repeat = &stats
+	result.Score = Score(result)
+	return result
+}
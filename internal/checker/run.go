@@ -0,0 +1,104 @@
+package checker
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"vpn_checker/internal/parser"
+)
+
+// Run is a CheckAll running in the background whose progress can be polled
+// from other goroutines while it goes, e.g. by the web control API.
+type Run struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	mu       sync.Mutex
+	progress RunProgress
+	results  []Result
+}
+
+// RunProgress is a snapshot of a Run.
+type RunProgress struct {
+	Running    bool       `json:"running"`
+	Stopped    bool       `json:"stopped,omitempty"` // Stop was called before the run finished
+	Done       int        `json:"done"`
+	Total      int        `json:"total"`
+	Alive      int        `json:"alive"`
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+// StartRun starts checking configs in a new goroutine and returns at once.
+// onResult, if set, is called like CheckAll's after the Run's own bookkeeping.
+func StartRun(configs []parser.ProxyConfig, workers int, timeout time.Duration, onResult func(Result, int, int)) *Run {
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &Run{
+		cancel: cancel,
+		done:   make(chan struct{}),
+		progress: RunProgress{
+			Running:   true,
+			Total:     len(configs),
+			StartedAt: time.Now(),
+		},
+	}
+	go func() {
+		defer close(r.done)
+		defer cancel()
+		results := CheckAllContext(ctx, configs, workers, timeout, func(res Result, done, total int) {
+			r.mu.Lock()
+			r.progress.Done = done
+			if res.Alive {
+				r.progress.Alive++
+			}
+			r.mu.Unlock()
+			if onResult != nil {
+				onResult(res, done, total)
+			}
+		})
+		now := time.Now()
+		r.mu.Lock()
+		r.results = results
+		r.progress.Running = false
+		r.progress.FinishedAt = &now
+		r.mu.Unlock()
+	}()
+	return r
+}
+
+// Progress returns the current state of the run.
+func (r *Run) Progress() RunProgress {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.progress
+}
+
+// Results returns the results once the run has finished; ok is false while
+// it is still running. A stopped run has only the configs finished in time.
+func (r *Run) Results() (results []Result, ok bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.progress.Running {
+		return nil, false
+	}
+	return r.results, true
+}
+
+// Stop cancels the run and waits until its checks in flight are aborted.
+func (r *Run) Stop() {
+	r.mu.Lock()
+	if r.progress.Running {
+		r.progress.Stopped = true
+	}
+	r.mu.Unlock()
+	r.cancel()
+	<-r.done
+}
+
+// Wait blocks until the run finishes and returns its results.
+func (r *Run) Wait() []Result {
+	<-r.done
+	results, _ := r.Results()
+	return results
+}
@@ -0,0 +1,103 @@
+package checker
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ScoreWeights are the relative weights of the components of Result.Score.
+// A component only takes part when it was measured: IPv6 needs CheckIPv6,
+// success and jitter need several attempts of the config (Repeats).
+type ScoreWeights struct {
+	Latency float64
+	IPv6    float64
+	Success float64
+	Jitter  float64
+}
+
+// Weights is applied by CheckConfig when computing Result.Score.
+var Weights = ScoreWeights{Latency: 1, IPv6: 0.25, Success: 1, Jitter: 0.5}
+
+// scoreLatencyCap is the latency at which the latency component reaches 0.
+const scoreLatencyCap = 2 * time.Second
+
+// scoreJitterCap is the latency spread at which the jitter component reaches 0.
+const scoreJitterCap = 500 * time.Millisecond
+
+// Score rates a result from 0 to 100. Dead configs score 0. For alive ones it
+// is the weighted mean of the measured components, each in [0, 1]:
+//
+//	latency = 1 - min(Latency / 2s, 1)
+//	ipv6    = 1 if HasIPv6 else 0                  (only with CheckIPv6)
+//	success = Repeat.SuccessRate()                 (only with Repeat)
+//	jitter  = 1 - min((P90 - Min) / 500ms, 1)      (only with 2+ successful repeats)
+//
+// UDP support is not scored: checks don't measure it.
+func Score(r Result) float64 {
+	if !r.Alive {
+		return 0
+	}
+	sum, total := Weights.Latency*capped(r.Latency, scoreLatencyCap), Weights.Latency
+	if CheckIPv6 {
+		if r.HasIPv6 {
+			sum += Weights.IPv6
+		}
+		total += Weights.IPv6
+	}
+	if rs := r.Repeat; rs != nil && rs.Runs > 1 {
+		sum += Weights.Success * rs.SuccessRate()
+		total += Weights.Success
+		if rs.OK > 1 {
+			sum += Weights.Jitter * capped(rs.LatencyP90-rs.LatencyMin, scoreJitterCap)
+			total += Weights.Jitter
+		}
+	}
+	if total <= 0 {
+		return 0
+	}
+	return 100 * sum / total
+}
+
+// capped maps d to 1 - min(d/limit, 1).
+func capped(d, limit time.Duration) float64 {
+	v := 1 - float64(d)/float64(limit)
+	if v < 0 {
+		return 0
+	}
+	return v
+}
+
+// ParseScoreWeights parses "latency=1,ipv6=0.25,success=1,jitter=0.5"; components not mentioned
+// keep their value from base.
+func ParseScoreWeights(s string, base ScoreWeights) (ScoreWeights, error) {
+	w := base
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		key, val, ok := strings.Cut(item, "=")
+		if !ok {
+			return w, fmt.Errorf("expected name=weight, got %q", item)
+		}
+		f, err := strconv.ParseFloat(strings.TrimSpace(val), 64)
+		if err != nil || f < 0 {
+			return w, fmt.Errorf("invalid weight %q for %s", val, key)
+		}
+		switch strings.TrimSpace(key) {
+		case "latency":
+			w.Latency = f
+		case "ipv6":
+			w.IPv6 = f
+		case "success":
+			w.Success = f
+		case "jitter":
+			w.Jitter = f
+		default:
+			return w, fmt.Errorf("unknown score component %q (supported: latency, ipv6, success, jitter)", key)
+		}
+	}
+	return w, nil
+}
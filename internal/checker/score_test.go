@@ -0,0 +1,57 @@
+package checker
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestScore(t *testing.T) {
+	defer func(w ScoreWeights, ipv6 bool) { Weights, CheckIPv6 = w, ipv6 }(Weights, CheckIPv6)
+	Weights = ScoreWeights{Latency: 1, IPv6: 1, Success: 1, Jitter: 1}
+	CheckIPv6 = false
+
+	stable := &RepeatStats{Runs: 4, OK: 4, LatencyMin: 500 * time.Millisecond, LatencyP90: 500 * time.Millisecond}
+	flaky := &RepeatStats{Runs: 4, OK: 2, LatencyMin: 500 * time.Millisecond, LatencyP90: 750 * time.Millisecond}
+	once := &RepeatStats{Runs: 4, OK: 1, LatencyMin: 500 * time.Millisecond, LatencyP90: 500 * time.Millisecond}
+	tests := []struct {
+		name string
+		r    Result
+		want float64
+	}{
+		{"dead", Result{Latency: time.Second}, 0},
+		{"latency only", Result{Alive: true, Latency: 500 * time.Millisecond}, 75},
+		{"over the cap", Result{Alive: true, Latency: 3 * time.Second}, 0},
+		// (0.75 + 1 + 1) / 3
+		{"stable repeats", Result{Alive: true, Latency: 500 * time.Millisecond, Repeat: stable}, 100 * 2.75 / 3},
+		// (0.75 + 0.5 + 0.5) / 3
+		{"flaky repeats", Result{Alive: true, Latency: 500 * time.Millisecond, Repeat: flaky}, 100 * 1.75 / 3},
+		// one success has no spread: (0.75 + 0.25) / 2
+		{"single success", Result{Alive: true, Latency: 500 * time.Millisecond, Repeat: once}, 50},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Score(tt.r); math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("Score = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	CheckIPv6 = true
+	if got := Score(Result{Alive: true, Latency: 500 * time.Millisecond, HasIPv6: true}); got != 87.5 {
+		t.Errorf("with IPv6: Score = %v, want 87.5", got)
+	}
+}
+
+func TestParseScoreWeights(t *testing.T) {
+	w, err := ParseScoreWeights("jitter=0, success=2", Weights)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w.Jitter != 0 || w.Success != 2 || w.Latency != Weights.Latency || w.IPv6 != Weights.IPv6 {
+		t.Errorf("got %+v", w)
+	}
+	if _, err := ParseScoreWeights("udp=1", Weights); err == nil {
+		t.Error("unknown component accepted")
+	}
+}
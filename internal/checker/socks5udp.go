@@ -0,0 +1,185 @@
+package checker
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+)
+
+// SOCKS5UDP is a UDP ASSOCIATE session (RFC 1928 §7) through a SOCKS5 proxy.
+// golang.org/x/net/proxy only speaks CONNECT, so this covers the UDP side:
+// the TCP control connection is held open for the lifetime of the session and
+// datagrams are exchanged with the relay address the proxy returned.
+type SOCKS5UDP struct {
+	ctrl  net.Conn
+	relay *net.UDPConn
+}
+
+// DialSOCKS5UDP opens a UDP association on the no-auth SOCKS5 proxy at socksAddr.
+func DialSOCKS5UDP(socksAddr string, timeout time.Duration) (*SOCKS5UDP, error) {
+	ctrl, err := net.DialTimeout("tcp", socksAddr, timeout)
+	if err != nil {
+		return nil, fmt.Errorf("socks5 udp: %w", err)
+	}
+	_ = ctrl.SetDeadline(time.Now().Add(timeout))
+
+	relayAddr, err := udpAssociate(ctrl)
+	if err != nil {
+		ctrl.Close()
+		return nil, fmt.Errorf("socks5 udp: %w", err)
+	}
+	// A wildcard bind address means "same host as the proxy".
+	if relayAddr.IP.IsUnspecified() {
+		host, _, _ := net.SplitHostPort(socksAddr)
+		relayAddr.IP = net.ParseIP(host)
+	}
+	relay, err := net.DialUDP("udp", nil, relayAddr)
+	if err != nil {
+		ctrl.Close()
+		return nil, fmt.Errorf("socks5 udp relay: %w", err)
+	}
+	_ = ctrl.SetDeadline(time.Time{})
+	return &SOCKS5UDP{ctrl: ctrl, relay: relay}, nil
+}
+
+// udpAssociate performs the greeting and UDP ASSOCIATE request on ctrl and
+// returns the relay address from the reply.
+func udpAssociate(ctrl net.Conn) (*net.UDPAddr, error) {
+	if _, err := ctrl.Write([]byte{5, 1, 0}); err != nil {
+		return nil, err
+	}
+	greet := make([]byte, 2)
+	if _, err := io.ReadFull(ctrl, greet); err != nil {
+		return nil, err
+	}
+	if greet[0] != 5 || greet[1] != 0 {
+		return nil, errors.New("proxy requires authentication")
+	}
+
+	// UDP ASSOCIATE with DST 0.0.0.0:0 — we don't know our source address yet
+	if _, err := ctrl.Write([]byte{5, 3, 0, 1, 0, 0, 0, 0, 0, 0}); err != nil {
+		return nil, err
+	}
+	hdr := make([]byte, 3)
+	if _, err := io.ReadFull(ctrl, hdr); err != nil {
+		return nil, err
+	}
+	if hdr[1] != 0 {
+		return nil, fmt.Errorf("udp associate rejected (code %d)", hdr[1])
+	}
+	host, port, err := readSOCKSAddr(ctrl)
+	if err != nil {
+		return nil, err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		ips, err := net.LookupIP(host)
+		if err != nil || len(ips) == 0 {
+			return nil, fmt.Errorf("resolve relay %s: %v", host, err)
+		}
+		ip = ips[0]
+	}
+	return &net.UDPAddr{IP: ip, Port: port}, nil
+}
+
+// WriteTo sends payload to target (host:port) through the relay.
+func (s *SOCKS5UDP) WriteTo(payload []byte, target string) error {
+	host, portStr, err := net.SplitHostPort(target)
+	if err != nil {
+		return err
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return fmt.Errorf("invalid port %q", portStr)
+	}
+
+	pkt := []byte{0, 0, 0} // RSV RSV FRAG
+	if ip := net.ParseIP(host); ip != nil {
+		if ip4 := ip.To4(); ip4 != nil {
+			pkt = append(append(pkt, 1), ip4...)
+		} else {
+			pkt = append(append(pkt, 4), ip.To16()...)
+		}
+	} else {
+		if len(host) > 255 {
+			return fmt.Errorf("host too long: %s", host)
+		}
+		pkt = append(append(pkt, 3, byte(len(host))), host...)
+	}
+	pkt = binary.BigEndian.AppendUint16(pkt, uint16(port))
+	pkt = append(pkt, payload...)
+
+	_, err = s.relay.Write(pkt)
+	return err
+}
+
+// ReadFrom reads one datagram, returning its payload and the sender address.
+// Fragmented datagrams are not supported and are dropped.
+func (s *SOCKS5UDP) ReadFrom(buf []byte, deadline time.Time) (int, string, error) {
+	_ = s.relay.SetReadDeadline(deadline)
+	pkt := make([]byte, 64<<10)
+	for {
+		n, err := s.relay.Read(pkt)
+		if err != nil {
+			return 0, "", err
+		}
+		if n < 4 || pkt[2] != 0 {
+			continue
+		}
+		r := bytes.NewReader(pkt[3:n])
+		host, port, err := readSOCKSAddr(r)
+		if err != nil {
+			continue
+		}
+		m, _ := r.Read(buf)
+		return m, net.JoinHostPort(host, strconv.Itoa(port)), nil
+	}
+}
+
+// Close ends the association.
+func (s *SOCKS5UDP) Close() error {
+	s.relay.Close()
+	return s.ctrl.Close()
+}
+
+// readSOCKSAddr reads ATYP, ADDR and PORT as used in SOCKS5 replies and UDP headers.
+func readSOCKSAddr(r io.Reader) (string, int, error) {
+	atyp := make([]byte, 1)
+	if _, err := io.ReadFull(r, atyp); err != nil {
+		return "", 0, err
+	}
+	var host string
+	switch atyp[0] {
+	case 1, 4:
+		ip := make([]byte, net.IPv4len)
+		if atyp[0] == 4 {
+			ip = make([]byte, net.IPv6len)
+		}
+		if _, err := io.ReadFull(r, ip); err != nil {
+			return "", 0, err
+		}
+		host = net.IP(ip).String()
+	case 3:
+		n := make([]byte, 1)
+		if _, err := io.ReadFull(r, n); err != nil {
+			return "", 0, err
+		}
+		name := make([]byte, n[0])
+		if _, err := io.ReadFull(r, name); err != nil {
+			return "", 0, err
+		}
+		host = string(name)
+	default:
+		return "", 0, fmt.Errorf("unknown address type %d", atyp[0])
+	}
+	port := make([]byte, 2)
+	if _, err := io.ReadFull(r, port); err != nil {
+		return "", 0, err
+	}
+	return host, int(binary.BigEndian.Uint16(port)), nil
+}
@@ -0,0 +1,154 @@
+package checker
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// startUDPEcho serves a UDP echo on loopback and returns its address.
+func startUDPEcho(t *testing.T) *net.UDPAddr {
+	t.Helper()
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	go func() {
+		buf := make([]byte, 64<<10)
+		for {
+			n, from, err := conn.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+			conn.WriteToUDP(buf[:n], from)
+		}
+	}()
+	return conn.LocalAddr().(*net.UDPAddr)
+}
+
+// startSOCKS5UDPRelay serves the no-auth UDP ASSOCIATE subset of SOCKS5 on
+// loopback: one association per control connection, relaying datagrams for
+// IPv4 targets. It returns the control address.
+func startSOCKS5UDPRelay(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			ctrl, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serveUDPAssociate(ctrl)
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func serveUDPAssociate(ctrl net.Conn) {
+	defer ctrl.Close()
+	greet := make([]byte, 3)
+	if _, err := io.ReadFull(ctrl, greet); err != nil {
+		return
+	}
+	ctrl.Write([]byte{5, 0})
+	req := make([]byte, 10)
+	if _, err := io.ReadFull(ctrl, req); err != nil || req[1] != 3 {
+		return
+	}
+
+	relay, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		return
+	}
+	defer relay.Close()
+	// Reply with a wildcard bind address, which the client must map to the
+	// proxy's own host.
+	reply := []byte{5, 0, 0, 1, 0, 0, 0, 0}
+	reply = binary.BigEndian.AppendUint16(reply, uint16(relay.LocalAddr().(*net.UDPAddr).Port))
+	ctrl.Write(reply)
+
+	go func() {
+		var client *net.UDPAddr
+		buf := make([]byte, 64<<10)
+		for {
+			n, from, err := relay.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+			if client == nil || from.String() == client.String() {
+				// client → target: RSV RSV FRAG ATYP=1 IP PORT DATA
+				client = from
+				if n < 10 || buf[3] != 1 {
+					continue
+				}
+				target := &net.UDPAddr{IP: net.IP(buf[4:8]), Port: int(binary.BigEndian.Uint16(buf[8:10]))}
+				relay.WriteToUDP(buf[10:n], target)
+				continue
+			}
+			// target → client, prefixed with the sender's address
+			pkt := append([]byte{0, 0, 0, 1}, from.IP.To4()...)
+			pkt = binary.BigEndian.AppendUint16(pkt, uint16(from.Port))
+			relay.WriteToUDP(append(pkt, buf[:n]...), client)
+		}
+	}()
+	// The association lives as long as the control connection.
+	io.Copy(io.Discard, ctrl)
+}
+
+func TestSOCKS5UDPEcho(t *testing.T) {
+	echo := startUDPEcho(t)
+	proxyAddr := startSOCKS5UDPRelay(t)
+
+	s, err := DialSOCKS5UDP(proxyAddr, 2*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	payload := []byte("ping through socks5")
+	if err := s.WriteTo(payload, echo.String()); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 1500)
+	n, from, err := s.ReadFrom(buf, time.Now().Add(2*time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf[:n], payload) {
+		t.Errorf("echo = %q, want %q", buf[:n], payload)
+	}
+	if from != echo.String() {
+		t.Errorf("reply from %s, want %s", from, echo)
+	}
+}
+
+func TestSOCKS5UDPRejected(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		ctrl, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer ctrl.Close()
+		io.ReadFull(ctrl, make([]byte, 3))
+		ctrl.Write([]byte{5, 0})
+		io.ReadFull(ctrl, make([]byte, 10))
+		ctrl.Write([]byte{5, 7, 0, 1, 0, 0, 0, 0, 0, 0}) // command not supported
+	}()
+
+	if _, err := DialSOCKS5UDP(ln.Addr().String(), 2*time.Second); err == nil {
+		t.Fatal("DialSOCKS5UDP succeeded although the proxy rejected UDP ASSOCIATE")
+	}
+}
@@ -0,0 +1,113 @@
+package checker
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// SpeedTest measures download throughput through every alive config into
+// Result.DownloadMbps; SpeedTestUpload adds an upload measurement into
+// Result.UploadMbps. Each transfer is bounded by the check timeout. A failed
+// measurement is noted in Result.Warning and never affects Alive.
+var (
+	SpeedTest       bool
+	SpeedTestUpload bool
+)
+
+// SpeedDownloadURL serves the download payload and SpeedUploadURL accepts
+// the upload POST. Public upload endpoints come and go, so both can be
+// pointed elsewhere (-speedtest-url, -speedtest-upload-url).
+var (
+	SpeedDownloadURL = "https://speed.cloudflare.com/__down?bytes=10000000"
+	SpeedUploadURL   = "https://speed.cloudflare.com/__up"
+)
+
+// speedUploadBytes is the size of the upload payload.
+const speedUploadBytes = 5 << 20
+
+// runSpeedTests fills in the throughput fields of an alive result.
+func runSpeedTests(ctx context.Context, result *Result, transport *http.Transport, timeout time.Duration) {
+	client := &http.Client{Transport: transport, Timeout: timeout}
+	mbps, err := measureDownload(ctx, client, SpeedDownloadURL)
+	if err != nil {
+		result.addWarning("speedtest download: " + err.Error())
+	}
+	result.DownloadMbps = mbps
+	if !SpeedTestUpload {
+		return
+	}
+	mbps, err = measureUpload(ctx, client, SpeedUploadURL)
+	if err != nil {
+		result.addWarning("speedtest upload: " + err.Error())
+	}
+	result.UploadMbps = mbps
+}
+
+// measureDownload reads target's body to the end. When the timeout cuts the
+// transfer short, the rate over the bytes received so far is still returned.
+func measureDownload(ctx context.Context, client *http.Client, target string) (float64, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return 0, err
+	}
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	n, err := io.Copy(io.Discard, resp.Body)
+	if n == 0 {
+		if err == nil {
+			err = fmt.Errorf("empty response")
+		}
+		return 0, err
+	}
+	return mbps(n, time.Since(start)), nil
+}
+
+// measureUpload POSTs speedUploadBytes to target and times it until the
+// response arrives, i.e. until the server has received the whole body.
+func measureUpload(ctx context.Context, client *http.Client, target string) (float64, error) {
+	body := io.LimitReader(zeroReader{}, speedUploadBytes)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, body)
+	if err != nil {
+		return 0, err
+	}
+	req.ContentLength = speedUploadBytes
+	req.Header.Set("Content-Type", "application/octet-stream")
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	elapsed := time.Since(start)
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return 0, fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	return mbps(speedUploadBytes, elapsed), nil
+}
+
+// mbps converts n bytes transferred in d to megabits per second.
+func mbps(n int64, d time.Duration) float64 {
+	if d <= 0 {
+		return 0
+	}
+	return float64(n) * 8 / d.Seconds() / 1e6
+}
+
+// zeroReader is an endless source of zero bytes for upload payloads.
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
@@ -0,0 +1,70 @@
+package checker
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync/atomic"
+	"time"
+
+	"vpn_checker/internal/parser"
+	xrayrunner "vpn_checker/internal/xray"
+)
+
+// TunMode runs each check through an xray tun inbound instead of SOCKS: the
+// geo request is sent from a socket bound to the tun interface, so it takes
+// the IP-level path a phone or desktop client would. See TunSupported.
+var TunMode bool
+
+// tunSeq numbers tun interfaces so concurrent checks never share a name.
+var tunSeq atomic.Uint32
+
+// startTun launches xray with a tun inbound for cfg and returns a dial
+// function bound to the new interface. Like startTunnel, the process is
+// returned alongside an error once it has been started.
+func startTun(idx int, name string, cfg parser.ProxyConfig) (func(ctx context.Context, network, addr string) (net.Conn, error), xrayrunner.Process, error) {
+	if err := TunSupported(); err != nil {
+		return nil, nil, err
+	}
+	// IFNAMSIZ is 16 including the NUL, so keep the name short.
+	tunName := fmt.Sprintf("vpnchk%d", tunSeq.Add(1)%100000)
+
+	configJSON, err := xrayrunner.GenerateTunConfig(cfg, tunName)
+	if err != nil {
+		return nil, nil, fmt.Errorf("config gen: %v", err)
+	}
+	if DumpDir != "" {
+		if err := dumpConfig(idx, name, configJSON); err != nil {
+			return nil, nil, fmt.Errorf("dump config: %v", err)
+		}
+	}
+
+	if ValidateConfigs {
+		if err := Runner.Validate(configJSON); err != nil {
+			return nil, nil, fmt.Errorf("invalid config: %v", err)
+		}
+	}
+
+	proc, err := Runner.Start(configJSON)
+	if err != nil {
+		return nil, nil, fmt.Errorf("xray start: %v", err)
+	}
+	if err := waitForInterface(tunName, 3*time.Second); err != nil {
+		return nil, proc, fmt.Errorf("xray not ready: %v", err)
+	}
+
+	dialer := &net.Dialer{Control: bindToDevice(tunName)}
+	return dialer.DialContext, proc, nil
+}
+
+// waitForInterface polls until the named interface exists and is up.
+func waitForInterface(name string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if ifi, err := net.InterfaceByName(name); err == nil && ifi.Flags&net.FlagUp != 0 {
+			return nil
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	return fmt.Errorf("timeout waiting for interface %s", name)
+}
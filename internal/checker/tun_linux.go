@@ -0,0 +1,33 @@
+//go:build linux
+
+package checker
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// TunSupported reports whether TunMode can work here: creating the interface
+// and binding sockets to it need root (CAP_NET_ADMIN / CAP_NET_RAW).
+func TunSupported() error {
+	if os.Geteuid() != 0 {
+		return errors.New("tun mode needs root (CAP_NET_ADMIN) to create the interface")
+	}
+	return nil
+}
+
+// bindToDevice returns a net.Dialer Control hook that pins the socket to dev
+// with SO_BINDTODEVICE, so its traffic leaves through the tun interface.
+func bindToDevice(dev string) func(network, address string, c syscall.RawConn) error {
+	return func(network, address string, c syscall.RawConn) error {
+		var sockErr error
+		err := c.Control(func(fd uintptr) {
+			sockErr = syscall.SetsockoptString(int(fd), syscall.SOL_SOCKET, syscall.SO_BINDTODEVICE, dev)
+		})
+		if err != nil {
+			return err
+		}
+		return sockErr
+	}
+}
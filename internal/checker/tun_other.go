@@ -0,0 +1,19 @@
+//go:build !linux
+
+package checker
+
+import (
+	"fmt"
+	"runtime"
+	"syscall"
+)
+
+// TunSupported reports whether TunMode can work here; binding sockets to the
+// tun interface is only implemented on Linux.
+func TunSupported() error {
+	return fmt.Errorf("tun mode is not supported on %s", runtime.GOOS)
+}
+
+func bindToDevice(dev string) func(network, address string, c syscall.RawConn) error {
+	return nil
+}
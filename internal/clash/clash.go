@@ -0,0 +1,243 @@
+package clash
+
+import (
+	"fmt"
+	"strconv"
+
+	"gopkg.in/yaml.v3"
+
+	"vpn_checker/internal/parser"
+)
+
+// document is the subset of a Clash config.yaml we care about
+type document struct {
+	Proxies []proxy `yaml:"proxies"`
+}
+
+// proxy is a single entry of the Clash proxies: list
+type proxy struct {
+	Name     string      `yaml:"name"`
+	Type     string      `yaml:"type"`
+	Server   string      `yaml:"server"`
+	Port     interface{} `yaml:"port"` // int or string
+	Password string      `yaml:"password"`
+	Cipher   string      `yaml:"cipher"`
+	UUID     string      `yaml:"uuid"`
+	AlterID  interface{} `yaml:"alterId"`
+	Flow     string      `yaml:"flow"`
+	Username string      `yaml:"username"`
+
+	TLS            bool   `yaml:"tls"`
+	SkipCertVerify bool   `yaml:"skip-cert-verify"`
+	ServerName     string `yaml:"servername"`
+	SNI            string `yaml:"sni"`
+	Fingerprint    string `yaml:"client-fingerprint"`
+
+	Network string `yaml:"network"`
+	WSOpts  struct {
+		Path    string            `yaml:"path"`
+		Headers map[string]string `yaml:"headers"`
+	} `yaml:"ws-opts"`
+	H2Opts struct {
+		Host []string `yaml:"host"`
+		Path string   `yaml:"path"`
+	} `yaml:"h2-opts"`
+	GRPCOpts struct {
+		ServiceName string `yaml:"grpc-service-name"`
+	} `yaml:"grpc-opts"`
+	RealityOpts struct {
+		PublicKey string `yaml:"public-key"`
+		ShortID   string `yaml:"short-id"`
+	} `yaml:"reality-opts"`
+}
+
+// Skipped describes a proxy entry that could not be mapped to a ProxyConfig.
+type Skipped struct {
+	Name   string
+	Type   string
+	Reason string
+}
+
+// Parse reads a Clash config.yaml and maps its proxies: list to ProxyConfig
+// values. Entries of unsupported types are returned in skipped.
+func Parse(data []byte) ([]parser.ProxyConfig, []Skipped, error) {
+	var doc document
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, nil, fmt.Errorf("clash yaml: %w", err)
+	}
+
+	var (
+		configs []parser.ProxyConfig
+		skipped []Skipped
+	)
+	for _, p := range doc.Proxies {
+		cfg, err := convert(p)
+		if err != nil {
+			skipped = append(skipped, Skipped{Name: p.Name, Type: p.Type, Reason: err.Error()})
+			continue
+		}
+		configs = append(configs, cfg)
+	}
+	return configs, skipped, nil
+}
+
+func convert(p proxy) (parser.ProxyConfig, error) {
+	port, err := toInt(p.Port)
+	if err != nil || port <= 0 {
+		return nil, fmt.Errorf("invalid port %v", p.Port)
+	}
+	if p.Server == "" {
+		return nil, fmt.Errorf("missing server")
+	}
+	name := p.Name
+	if name == "" {
+		name = fmt.Sprintf("%s:%d", p.Server, port)
+	}
+
+	sni := p.ServerName
+	if sni == "" {
+		sni = p.SNI
+	}
+	host, path := p.transportHostPath()
+
+	switch p.Type {
+	case "ss":
+		return &parser.SSConfig{
+			Name:     name,
+			Method:   p.Cipher,
+			Password: p.Password,
+			Server:   p.Server,
+			Port:     port,
+		}, nil
+
+	case "vmess":
+		aid, _ := toInt(p.AlterID)
+		tls := ""
+		switch {
+		case p.RealityOpts.PublicKey != "":
+			tls = "reality"
+		case p.TLS:
+			tls = "tls"
+		}
+		cipher := p.Cipher
+		if cipher == "" {
+			cipher = "auto"
+		}
+		return &parser.VmessConfig{
+			Name:     name,
+			UUID:     p.UUID,
+			Server:   p.Server,
+			Port:     port,
+			Aid:      aid,
+			Security: cipher,
+			Network:  p.Network,
+			TLS:      tls,
+			SNI:      sni,
+			Host:     host,
+			Path:     path,
+
+			Fp:            p.Fingerprint,
+			PublicKey:     p.RealityOpts.PublicKey,
+			ShortID:       p.RealityOpts.ShortID,
+			AllowInsecure: p.SkipCertVerify,
+		}, nil
+
+	case "vless":
+		security := ""
+		switch {
+		case p.RealityOpts.PublicKey != "":
+			security = "reality"
+		case p.TLS:
+			security = "tls"
+		}
+		return &parser.VlessConfig{
+			Name:      name,
+			UUID:      p.UUID,
+			Server:    p.Server,
+			Port:      port,
+			Security:  security,
+			Type:      p.Network,
+			SNI:       sni,
+			Host:      host,
+			Path:      path,
+			Fp:        p.Fingerprint,
+			Flow:      p.Flow,
+			PublicKey: p.RealityOpts.PublicKey,
+			ShortID:   p.RealityOpts.ShortID,
+		}, nil
+
+	case "trojan":
+		security := "tls"
+		if p.RealityOpts.PublicKey != "" {
+			security = "reality"
+		}
+		return &parser.TrojanConfig{
+			Name:      name,
+			Password:  p.Password,
+			Server:    p.Server,
+			Port:      port,
+			Security:  security,
+			Type:      p.Network,
+			SNI:       sni,
+			Host:      host,
+			Path:      path,
+			Fp:        p.Fingerprint,
+			PublicKey: p.RealityOpts.PublicKey,
+			ShortID:   p.RealityOpts.ShortID,
+		}, nil
+
+	case "socks5":
+		return &parser.SocksConfig{
+			Name:     name,
+			Server:   p.Server,
+			Port:     port,
+			Username: p.Username,
+			Password: p.Password,
+		}, nil
+
+	case "http":
+		return &parser.HttpConfig{
+			Name:     name,
+			Server:   p.Server,
+			Port:     port,
+			Username: p.Username,
+			Password: p.Password,
+			TLS:      p.TLS,
+		}, nil
+	}
+	return nil, fmt.Errorf("unsupported clash proxy type %q", p.Type)
+}
+
+// transportHostPath extracts host/path (or gRPC service name) from the
+// network-specific options block.
+func (p proxy) transportHostPath() (host, path string) {
+	switch p.Network {
+	case "ws":
+		return p.WSOpts.Headers["Host"], p.WSOpts.Path
+	case "h2", "http":
+		if len(p.H2Opts.Host) > 0 {
+			host = p.H2Opts.Host[0]
+		}
+		return host, p.H2Opts.Path
+	case "grpc":
+		return "", p.GRPCOpts.ServiceName
+	}
+	return "", ""
+}
+
+// toInt coerces a yaml number/string to int
+func toInt(v interface{}) (int, error) {
+	switch x := v.(type) {
+	case int:
+		return x, nil
+	case string:
+		if x == "" {
+			return 0, nil
+		}
+		return strconv.Atoi(x)
+	case nil:
+		return 0, nil
+	default:
+		return 0, fmt.Errorf("unexpected type %T", v)
+	}
+}
@@ -0,0 +1,81 @@
+// Package input recognizes the formats config lists arrive in, so callers can
+// route a file, clipboard or download to the right parser without being told.
+package input
+
+import (
+	"bytes"
+	"encoding/base64"
+	"regexp"
+	"strings"
+)
+
+// Format is the kind of text a config list came in.
+type Format int
+
+const (
+	// URIList is one share URI per line (blank and # comment lines allowed).
+	URIList Format = iota
+	// Base64 is a v2rayN-style subscription: the URI list, base64-encoded.
+	Base64
+	// ClashYAML is a Clash config with a proxies: list.
+	ClashYAML
+	// HTML is a page or other text with URIs embedded mid-line, e.g. a chat dump.
+	HTML
+)
+
+func (f Format) String() string {
+	switch f {
+	case Base64:
+		return "base64"
+	case ClashYAML:
+		return "clash-yaml"
+	case HTML:
+		return "html"
+	}
+	return "uri-list"
+}
+
+var (
+	clashProxies = regexp.MustCompile(`(?m)^proxies:\s*$`)
+	lineURI      = regexp.MustCompile(`(?im)^\s*(?:vless|vmess|trojan(?:-go)?|ss|socks5?|https?)://`)
+	htmlMarkup   = regexp.MustCompile(`(?i)<!doctype html|<html|<body|<a\s+href=|<div[\s>]|<br\s*/?>`)
+)
+
+// Detect guesses the format of data. Clash YAML is recognized by its
+// top-level proxies: key, base64 by decoding to something with URIs in it,
+// and HTML by markup or by URIs that never start a line. Anything else is
+// read as a plain URI list.
+func Detect(data []byte) Format {
+	switch {
+	case clashProxies.Match(data):
+		return ClashYAML
+	case lineURI.Match(data):
+		if htmlMarkup.Match(data) {
+			return HTML
+		}
+		return URIList
+	case !bytes.Contains(data, []byte("://")):
+		if _, ok := DecodeBase64(string(data)); ok {
+			return Base64
+		}
+		return URIList
+	}
+	// URIs present, but none at the start of a line
+	return HTML
+}
+
+// DecodeBase64 decodes a base64 subscription body (any of the standard and
+// URL alphabets, padded or not, wrapped across lines) and reports whether the
+// result contains URIs.
+func DecodeBase64(text string) (string, bool) {
+	trimmed := strings.Join(strings.Fields(text), "")
+	if trimmed == "" || strings.Contains(trimmed, "://") {
+		return "", false
+	}
+	for _, enc := range []*base64.Encoding{base64.StdEncoding, base64.RawStdEncoding, base64.URLEncoding, base64.RawURLEncoding} {
+		if dec, err := enc.DecodeString(trimmed); err == nil && strings.Contains(string(dec), "://") {
+			return string(dec), true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,25 @@
+package parser
+
+import (
+	"html"
+	"regexp"
+	"strings"
+)
+
+// uriPattern matches share URIs of the supported proxy schemes anywhere in a
+// string. A URI ends at whitespace, a quote, a backtick or an HTML tag
+// bracket. Plain http(s):// is deliberately left out: in pasted pages nearly
+// every match would be an ordinary link rather than a proxy.
+var uriPattern = regexp.MustCompile("(?i)\\b(?:vless|vmess|trojan(?:-go)?|ss|socks5?)://[^\\s\"'`<>]+")
+
+// ExtractURIs returns every proxy URI embedded in text, in order of
+// appearance, with HTML entities (&amp; in href attributes) decoded and
+// sentence punctuation directly after the URI dropped. It salvages configs
+// from chat exports and HTML pages where they sit mid-line.
+func ExtractURIs(text string) []string {
+	matches := uriPattern.FindAllString(text, -1)
+	for i, m := range matches {
+		matches[i] = strings.TrimRight(html.UnescapeString(m), ".,;:!?")
+	}
+	return matches
+}
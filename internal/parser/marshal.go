@@ -0,0 +1,210 @@
+package parser
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Marshal serializes a ProxyConfig back into a share URI. Query parameters are
+// emitted in sorted order and empty values are dropped, so two configs with
+// the same fields always produce byte-identical URIs.
+func Marshal(cfg ProxyConfig) (string, error) {
+	switch c := cfg.(type) {
+	case *VlessConfig:
+		return marshalVless(c), nil
+	case *SSConfig:
+		return marshalSS(c), nil
+	case *TrojanConfig:
+		return marshalTrojan(c), nil
+	case *VmessConfig:
+		return marshalVmess(c)
+	case *SocksConfig:
+		return buildURI("socks5", proxyUser(c.Username, c.Password), c.Server, c.Port, nil, c.Name), nil
+	case *HttpConfig:
+		scheme := "http"
+		if c.TLS {
+			scheme = "https"
+		}
+		return buildURI(scheme, proxyUser(c.Username, c.Password), c.Server, c.Port, nil, c.Name), nil
+	default:
+		return "", fmt.Errorf("marshal: unsupported config type %T", cfg)
+	}
+}
+
+func marshalVless(c *VlessConfig) string {
+	q := url.Values{}
+	setParam(q, "security", c.Security)
+	setParam(q, "type", c.Type)
+	setParam(q, "sni", c.SNI)
+	setTransport(q, c.Type, c.Host, c.Path)
+	setParam(q, "fp", c.Fp)
+	setParam(q, "encryption", c.Encryption)
+	setParam(q, "flow", c.Flow)
+	setParam(q, "pbk", c.PublicKey)
+	setParam(q, "sid", c.ShortID)
+	setParam(q, "mux", marshalMux(c.Mux))
+	setParam(q, "headerType", c.HeaderType)
+	setParam(q, "mode", c.Mode)
+	setParam(q, "extra", c.Extra)
+	return buildURI("vless", url.User(c.UUID), c.Server, c.Port, q, c.Name)
+}
+
+func marshalSS(c *SSConfig) string {
+	// SIP002: userinfo is base64url("method:password") without padding
+	userinfo := base64.RawURLEncoding.EncodeToString([]byte(c.Method + ":" + c.Password))
+	if c.Plugin == "" {
+		return buildURI("ss", url.User(userinfo), c.Server, c.Port, nil, c.Name)
+	}
+	// SIP002 puts the plugin query after a "/"; '?' can't occur earlier in
+	// the URI, since base64url userinfo and the host have none.
+	uri := buildURI("ss", url.User(userinfo), c.Server, c.Port, url.Values{"plugin": {c.Plugin}}, c.Name)
+	return strings.Replace(uri, "?", "/?", 1)
+}
+
+func marshalTrojan(c *TrojanConfig) string {
+	q := url.Values{}
+	setParam(q, "security", c.Security)
+	setParam(q, "type", c.Type)
+	setParam(q, "sni", c.SNI)
+	setTransport(q, c.Type, c.Host, c.Path)
+	setParam(q, "fp", c.Fp)
+	setParam(q, "pbk", c.PublicKey)
+	setParam(q, "sid", c.ShortID)
+	setParam(q, "mux", marshalMux(c.Mux))
+	setParam(q, "headerType", c.HeaderType)
+	setParam(q, "mode", c.Mode)
+	setParam(q, "extra", c.Extra)
+	if c.TrojanGo {
+		if c.SSMethod != "" {
+			q.Set("encryption", "ss;"+c.SSMethod+":"+c.SSPassword)
+		}
+		return buildURI("trojan-go", url.User(c.Password), c.Server, c.Port, q, c.Name)
+	}
+	return buildURI("trojan", url.User(c.Password), c.Server, c.Port, q, c.Name)
+}
+
+// vmessShareJSON is the v2rayN share-link payload. Field order is fixed so the
+// encoded output is canonical.
+type vmessShareJSON struct {
+	V    string `json:"v"`
+	PS   string `json:"ps"`
+	Add  string `json:"add"`
+	Port string `json:"port"`
+	ID   string `json:"id"`
+	Aid  string `json:"aid"`
+	Scy  string `json:"scy,omitempty"`
+	Net  string `json:"net,omitempty"`
+	Type string `json:"type,omitempty"`
+	Host string `json:"host,omitempty"`
+	Path string `json:"path,omitempty"`
+	TLS  string `json:"tls,omitempty"`
+	SNI  string `json:"sni,omitempty"`
+	Fp   string `json:"fp,omitempty"`
+	Pbk  string `json:"pbk,omitempty"`
+	Sid  string `json:"sid,omitempty"`
+	Spx  string `json:"spx,omitempty"`
+
+	AllowInsecure string `json:"allowInsecure,omitempty"`
+}
+
+func marshalVmess(c *VmessConfig) (string, error) {
+	insecure := ""
+	if c.AllowInsecure {
+		insecure = "1"
+	}
+	data, err := json.Marshal(vmessShareJSON{
+		V:    "2",
+		PS:   c.Name,
+		Add:  c.Server,
+		Port: strconv.Itoa(c.Port),
+		ID:   c.UUID,
+		Aid:  strconv.Itoa(c.Aid),
+		Scy:  c.Security,
+		Net:  c.Network,
+		Type: c.HeaderType,
+		Host: c.Host,
+		Path: c.Path,
+		TLS:  c.TLS,
+		SNI:  c.SNI,
+		Fp:   c.Fp,
+		Pbk:  c.PublicKey,
+		Sid:  c.ShortID,
+		Spx:  c.SpiderX,
+
+		AllowInsecure: insecure,
+	})
+	if err != nil {
+		return "", fmt.Errorf("marshal vmess: %w", err)
+	}
+	return "vmess://" + base64.StdEncoding.EncodeToString(data), nil
+}
+
+// setTransport writes host and path, as seed for kcp and quicSecurity/key for quic.
+func setTransport(q url.Values, network, host, path string) {
+	switch network {
+	case "kcp":
+		setParam(q, "host", host)
+		setParam(q, "seed", path)
+	case "quic":
+		setParam(q, "quicSecurity", host)
+		setParam(q, "key", path)
+	default:
+		setParam(q, "host", host)
+		setParam(q, "path", path)
+	}
+}
+
+// buildURI assembles scheme://user@host:port?query#name with proper escaping.
+func buildURI(scheme string, user *url.Userinfo, host string, port int, q url.Values, name string) string {
+	u := url.URL{
+		Scheme:   scheme,
+		User:     user,
+		Host:     net.JoinHostPort(host, strconv.Itoa(port)),
+		Fragment: name,
+	}
+	if len(q) > 0 {
+		u.RawQuery = q.Encode() // Encode sorts by key
+	}
+	u.RawFragment = escapeName(name)
+	return u.String()
+}
+
+// escapeName percent-encodes a display name for a URI fragment. '+' is
+// escaped too: decodeName reads a bare '+' as a space in names without other
+// escapes, so a literal plus has to survive as %2B.
+func escapeName(name string) string {
+	return strings.ReplaceAll((&url.URL{Fragment: name}).EscapedFragment(), "+", "%2B")
+}
+
+// proxyUser returns user:pass userinfo for plain proxies, or nil without credentials.
+func proxyUser(username, password string) *url.Userinfo {
+	switch {
+	case username == "" && password == "":
+		return nil
+	case password == "":
+		return url.User(username)
+	}
+	return url.UserPassword(username, password)
+}
+
+func setParam(q url.Values, key, value string) {
+	if value != "" {
+		q.Set(key, value)
+	}
+}
+
+// marshalMux is the inverse of parseMux.
+func marshalMux(n int) string {
+	switch {
+	case n < 0:
+		return "0"
+	case n == 0:
+		return ""
+	}
+	return strconv.Itoa(n)
+}
@@ -1,12 +1,16 @@
 package parser
 
 import (
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/url"
 	"strconv"
 	"strings"
+	"unicode/utf8"
 )
 
 // ProxyConfig is the common interface for all proxy types
@@ -26,13 +30,17 @@ type VlessConfig struct {
 	Security   string
 	Type       string
 	SNI        string
-	Host       string
-	Path       string
+	Host       string // quic: quic security
+	Path       string // kcp: seed, quic: key, grpc: service name
 	Fp         string
 	Encryption string
 	Flow       string
 	PublicKey  string // reality pbk
 	ShortID    string // reality sid
+	Mux        int    // mux concurrency: >0 enabled, -1 explicitly off, 0 unset
+	HeaderType string // tcp header obfuscation (headerType): "http" or none
+	Mode       string // xhttp mode: auto, packet-up, stream-up, stream-one
+	Extra      string // xhttp extra settings, raw JSON
 }
 
 func (v *VlessConfig) GetName() string     { return v.Name }
@@ -47,6 +55,7 @@ type SSConfig struct {
 	Password string
 	Server   string
 	Port     int
+	Plugin   string // SIP003 plugin=, e.g. "obfs-local;obfs=http"; xray can't run plugins
 }
 
 func (s *SSConfig) GetName() string     { return s.Name }
@@ -56,17 +65,25 @@ func (s *SSConfig) GetPort() int        { return s.Port }
 
 // VmessConfig holds parsed vmess:// URI parameters (JSON payload in base64)
 type VmessConfig struct {
-	Name     string
-	UUID     string
-	Server   string
-	Port     int
-	Aid      int
-	Security string // cipher: auto, aes-128-gcm, chacha20-poly1305, none
-	Network  string // net: tcp, ws, grpc, h2, kcp
-	TLS      string // tls / ""
-	SNI      string
-	Host     string
-	Path     string
+	Name       string
+	UUID       string
+	Server     string
+	Port       int
+	Aid        int
+	Security   string // cipher: auto, aes-128-gcm, chacha20-poly1305, none
+	Network    string // net: tcp, ws, grpc, h2, kcp, quic
+	TLS        string // tls / ""
+	SNI        string
+	Host       string // quic: quic security
+	Path       string // kcp: seed, quic: key, grpc: service name
+	HeaderType string // "type" field: tcp header obfuscation ("http") or kcp/quic header
+	Fp         string // uTLS fingerprint
+	PublicKey  string // reality pbk (TLS == "reality")
+	ShortID    string // reality sid
+	SpiderX    string // reality spx
+	// AllowInsecure skips TLS certificate verification (allowInsecure,
+	// skip-cert-verify or verify_cert=false in the share JSON)
+	AllowInsecure bool
 }
 
 func (v *VmessConfig) GetName() string     { return v.Name }
@@ -74,18 +91,29 @@ func (v *VmessConfig) GetProtocol() string { return "vmess" }
 func (v *VmessConfig) GetServer() string   { return v.Server }
 func (v *VmessConfig) GetPort() int        { return v.Port }
 
-// TrojanConfig holds parsed trojan:// URI parameters
+// TrojanConfig holds parsed trojan:// (and trojan-go://) URI parameters
 type TrojanConfig struct {
-	Name     string
-	Password string
-	Server   string
-	Port     int
-	Security string
-	Type     string
-	SNI      string
-	Host     string
-	Path     string
-	Fp       string
+	Name       string
+	Password   string
+	Server     string
+	Port       int
+	Security   string
+	Type       string
+	SNI        string
+	Host       string // quic: quic security
+	Path       string // kcp: seed, quic: key, grpc: service name
+	Fp         string
+	PublicKey  string // reality pbk
+	ShortID    string // reality sid
+	Mux        int    // mux concurrency: >0 enabled, -1 explicitly off, 0 unset
+	HeaderType string // tcp header obfuscation (headerType): "http" or none
+	Mode       string // xhttp mode: auto, packet-up, stream-up, stream-one
+	Extra      string // xhttp extra settings, raw JSON
+
+	// trojan-go only
+	TrojanGo   bool   // parsed from a trojan-go:// link
+	SSMethod   string // encryption=ss;method:password: shadowsocks AEAD layer inside the tunnel
+	SSPassword string
 }
 
 func (t *TrojanConfig) GetName() string     { return t.Name }
@@ -93,12 +121,46 @@ func (t *TrojanConfig) GetProtocol() string { return "trojan" }
 func (t *TrojanConfig) GetServer() string   { return t.Server }
 func (t *TrojanConfig) GetPort() int        { return t.Port }
 
+// SocksConfig holds parsed socks5:// (or socks://) proxy parameters
+type SocksConfig struct {
+	Name     string
+	Server   string
+	Port     int
+	Username string
+	Password string
+}
+
+func (s *SocksConfig) GetName() string     { return s.Name }
+func (s *SocksConfig) GetProtocol() string { return "socks" }
+func (s *SocksConfig) GetServer() string   { return s.Server }
+func (s *SocksConfig) GetPort() int        { return s.Port }
+
+// HttpConfig holds parsed http:// or https:// proxy parameters
+type HttpConfig struct {
+	Name     string
+	Server   string
+	Port     int
+	Username string
+	Password string
+	TLS      bool // https:// — TLS to the proxy itself
+}
+
+func (h *HttpConfig) GetName() string     { return h.Name }
+func (h *HttpConfig) GetProtocol() string { return "http" }
+func (h *HttpConfig) GetServer() string   { return h.Server }
+func (h *HttpConfig) GetPort() int        { return h.Port }
+
+// ErrCommentOrBlank is returned by ParseLine for blank and # comment lines,
+// which callers skip silently rather than report as parse failures.
+var ErrCommentOrBlank = errors.New("empty or comment line")
+
 // ParseLine parses a single URI line into a ProxyConfig
 func ParseLine(line string) (ProxyConfig, error) {
 	line = strings.TrimSpace(line)
 	if line == "" || strings.HasPrefix(line, "#") {
-		return nil, fmt.Errorf("empty or comment line")
+		return nil, ErrCommentOrBlank
 	}
+	line = lowerScheme(line)
 
 	switch {
 	case strings.HasPrefix(line, "vless://"):
@@ -107,14 +169,19 @@ func ParseLine(line string) (ProxyConfig, error) {
 		return parseSS(line)
 	case strings.HasPrefix(line, "vmess://"):
 		return parseVmess(line)
-	case strings.HasPrefix(line, "trojan://"):
+	case strings.HasPrefix(line, "trojan://"), strings.HasPrefix(line, "trojan-go://"):
 		return parseTrojan(line)
+	case strings.HasPrefix(line, "socks5://"), strings.HasPrefix(line, "socks://"):
+		return parseSocks(line)
+	case strings.HasPrefix(line, "http://"), strings.HasPrefix(line, "https://"):
+		return parseHttp(line)
 	default:
 		return nil, fmt.Errorf("unsupported protocol in: %s", line)
 	}
 }
 
 func parseVless(raw string) (*VlessConfig, error) {
+	raw, frag := cutFragment(raw)
 	u, err := url.Parse(raw)
 	if err != nil {
 		return nil, fmt.Errorf("vless parse error: %w", err)
@@ -133,6 +200,7 @@ func parseVless(raw string) (*VlessConfig, error) {
 	uuid := u.User.Username()
 	q := u.Query()
 
+	tHost, tPath := transportHostPath(q, u.RawQuery)
 	cfg := &VlessConfig{
 		UUID:       uuid,
 		Server:     host,
@@ -140,28 +208,47 @@ func parseVless(raw string) (*VlessConfig, error) {
 		Security:   q.Get("security"),
 		Type:       q.Get("type"),
 		SNI:        q.Get("sni"),
-		Host:       q.Get("host"),
-		Path:       q.Get("path"),
+		Host:       tHost,
+		Path:       tPath,
 		Fp:         q.Get("fp"),
-		Encryption: q.Get("encryption"),
+		Encryption: rawQueryParam(u.RawQuery, "encryption"),
 		Flow:       q.Get("flow"),
 		PublicKey:  q.Get("pbk"),
 		ShortID:    q.Get("sid"),
-		Name:       u.Fragment,
+		Mux:        parseMux(q.Get("mux")),
+		HeaderType: q.Get("headerType"),
+		Mode:       q.Get("mode"),
+		Extra:      q.Get("extra"),
+		Name:       decodeName(frag),
 	}
 
 	if cfg.Name == "" {
 		cfg.Name = fmt.Sprintf("%s:%d", host, port)
-	} else {
-		if dec, err := url.QueryUnescape(cfg.Name); err == nil {
-			cfg.Name = dec
-		}
 	}
 
 	return cfg, nil
 }
 
+// rawQueryParam returns the first value of key in rawQuery, unescaped without
+// form semantics: a literal '+' stays '+' instead of becoming a space. Values
+// such as vless post-quantum encryption strings (base64 key material joined
+// with '.') rely on this to survive parsing byte-for-byte.
+func rawQueryParam(rawQuery, key string) string {
+	for _, pair := range strings.Split(rawQuery, "&") {
+		k, v, _ := strings.Cut(pair, "=")
+		if k != key {
+			continue
+		}
+		if dec, err := url.PathUnescape(v); err == nil {
+			return dec
+		}
+		return v
+	}
+	return ""
+}
+
 func parseSS(raw string) (*SSConfig, error) {
+	raw, frag := cutFragment(raw)
 	u, err := url.Parse(raw)
 	if err != nil {
 		return nil, fmt.Errorf("ss parse error: %w", err)
@@ -177,25 +264,14 @@ func parseSS(raw string) (*SSConfig, error) {
 		return nil, fmt.Errorf("invalid port: %w", err)
 	}
 
-	// userinfo is base64-encoded "method:password"
-	userinfo := u.User.String()
-	decoded, err := base64DecodeUserinfo(userinfo)
+	parts, err := ssUserinfo(u.User)
 	if err != nil {
-		return nil, fmt.Errorf("ss userinfo decode error: %w", err)
+		return nil, err
 	}
 
-	parts := strings.SplitN(decoded, ":", 2)
-	if len(parts) != 2 {
-		return nil, fmt.Errorf("ss userinfo format invalid: %s", decoded)
-	}
-
-	name := u.Fragment
+	name := decodeName(frag)
 	if name == "" {
 		name = fmt.Sprintf("%s:%d", host, port)
-	} else {
-		if dec, err := url.QueryUnescape(name); err == nil {
-			name = dec
-		}
 	}
 
 	return &SSConfig{
@@ -204,6 +280,7 @@ func parseSS(raw string) (*SSConfig, error) {
 		Server:   host,
 		Port:     port,
 		Name:     name,
+		Plugin:   u.Query().Get("plugin"),
 	}, nil
 }
 
@@ -221,6 +298,41 @@ type vmessJSON struct {
 	TLS  string      `json:"tls"`
 	Type string      `json:"type"`
 	Host string      `json:"host"`
+	Fp   string      `json:"fp"`
+	Pbk  string      `json:"pbk"`
+	Sid  string      `json:"sid"`
+	Spx  string      `json:"spx"`
+
+	// AllowInsecure is resolved from the client-specific aliases in UnmarshalJSON
+	AllowInsecure bool `json:"-"`
+}
+
+// UnmarshalJSON accepts the key variants different clients export: v2rayN
+// uses sni/allowInsecure, Nekobox and Clash-derived exports use servername and
+// skip-cert-verify, Qv2ray uses verify_cert (inverted).
+func (v *vmessJSON) UnmarshalJSON(data []byte) error {
+	type plain vmessJSON
+	var aux struct {
+		plain
+		ServerName     string      `json:"servername"`
+		ServerNameCC   string      `json:"serverName"`
+		AllowInsecure  interface{} `json:"allowInsecure"`
+		SkipCertVerify interface{} `json:"skip-cert-verify"`
+		VerifyCert     interface{} `json:"verify_cert"`
+	}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+	*v = vmessJSON(aux.plain)
+	if v.SNI == "" {
+		v.SNI = aux.ServerName
+	}
+	if v.SNI == "" {
+		v.SNI = aux.ServerNameCC
+	}
+	v.AllowInsecure = toBool(aux.AllowInsecure) || toBool(aux.SkipCertVerify) ||
+		(aux.VerifyCert != nil && !toBool(aux.VerifyCert))
+	return nil
 }
 
 func parseVmess(raw string) (*VmessConfig, error) {
@@ -257,21 +369,29 @@ func parseVmess(raw string) (*VmessConfig, error) {
 	}
 
 	return &VmessConfig{
-		Name:     name,
-		UUID:     v.ID,
-		Server:   v.Add,
-		Port:     port,
-		Aid:      aid,
-		Security: sec,
-		Network:  v.Net,
-		TLS:      v.TLS,
-		SNI:      v.SNI,
-		Host:     v.Host,
-		Path:     v.Path,
+		Name:       name,
+		UUID:       v.ID,
+		Server:     v.Add,
+		Port:       port,
+		Aid:        aid,
+		Security:   sec,
+		Network:    v.Net,
+		TLS:        v.TLS,
+		SNI:        v.SNI,
+		Host:       v.Host,
+		Path:       v.Path,
+		HeaderType: v.Type,
+		Fp:         v.Fp,
+		PublicKey:  v.Pbk,
+		ShortID:    v.Sid,
+		SpiderX:    v.Spx,
+
+		AllowInsecure: v.AllowInsecure,
 	}, nil
 }
 
 func parseTrojan(raw string) (*TrojanConfig, error) {
+	raw, frag := cutFragment(raw)
 	u, err := url.Parse(raw)
 	if err != nil {
 		return nil, fmt.Errorf("trojan parse error: %w", err)
@@ -295,51 +415,295 @@ func parseTrojan(raw string) (*TrojanConfig, error) {
 		security = "tls" // trojan default
 	}
 
-	name := u.Fragment
+	name := decodeName(frag)
 	if name == "" {
 		name = fmt.Sprintf("%s:%d", host, port)
-	} else {
-		if dec, err := url.QueryUnescape(name); err == nil {
+	}
+
+	tHost, tPath := transportHostPath(q, u.RawQuery)
+	cfg := &TrojanConfig{
+		Name:       name,
+		Password:   password,
+		Server:     host,
+		Port:       port,
+		Security:   security,
+		Type:       q.Get("type"),
+		SNI:        q.Get("sni"),
+		Host:       tHost,
+		Path:       tPath,
+		Fp:         q.Get("fp"),
+		PublicKey:  q.Get("pbk"),
+		ShortID:    q.Get("sid"),
+		Mux:        parseMux(q.Get("mux")),
+		HeaderType: q.Get("headerType"),
+		Mode:       q.Get("mode"),
+		Extra:      q.Get("extra"),
+	}
+	if u.Scheme == "trojan-go" {
+		if err := applyTrojanGo(cfg, q); err != nil {
+			return nil, err
+		}
+	}
+	return cfg, nil
+}
+
+// applyTrojanGo maps the trojan-go share-link dialect onto cfg: type is
+// "original" (plain TCP) or "ws", and encryption optionally wraps the
+// stream in a shadowsocks AEAD layer as "ss;method:password" (trojan-go's own
+// links) or "ss;method;password" (some third-party exporters).
+func applyTrojanGo(cfg *TrojanConfig, q url.Values) error {
+	cfg.TrojanGo = true
+	switch cfg.Type {
+	case "", "original":
+		cfg.Type = ""
+	case "ws":
+	default:
+		return fmt.Errorf("trojan-go: unsupported type %q (want original or ws)", cfg.Type)
+	}
+
+	enc := q.Get("encryption")
+	if enc == "" || enc == "none" {
+		return nil
+	}
+	rest, ok := strings.CutPrefix(enc, "ss;")
+	sep := strings.IndexAny(rest, ":;")
+	if !ok || sep <= 0 {
+		return fmt.Errorf("trojan-go: invalid encryption %q (want ss;method:password)", enc)
+	}
+	cfg.SSMethod, cfg.SSPassword = rest[:sep], rest[sep+1:]
+	return nil
+}
+
+// Fingerprint returns a short stable identifier for a config built from its
+// protocol, endpoint, credentials and transport (network, security, host,
+// path, SNI, flow, reality key, SS plugin), so ws and grpc variants of one
+// server stay apart. The display name is ignored so renamed copies of the
+// same server share a fingerprint.
+func Fingerprint(cfg ProxyConfig) string {
+	secret, transport := "", ""
+	switch c := cfg.(type) {
+	case *VlessConfig:
+		secret = c.UUID
+		transport = transportKey(c.Type, c.Security, c.Host, c.Path, c.SNI, c.Flow, c.PublicKey, c.ShortID)
+	case *VmessConfig:
+		secret = c.UUID
+		transport = transportKey(c.Network, c.TLS, c.Host, c.Path, c.SNI, "", c.PublicKey, c.ShortID)
+	case *TrojanConfig:
+		secret = c.Password
+		transport = transportKey(c.Type, c.Security, c.Host, c.Path, c.SNI, "", c.PublicKey, c.ShortID)
+	case *SSConfig:
+		secret = c.Method + ":" + c.Password
+		transport = c.Plugin
+	case *SocksConfig:
+		secret = c.Username + ":" + c.Password
+	case *HttpConfig:
+		secret = c.Username + ":" + c.Password
+	}
+	key := fmt.Sprintf("%s|%s|%d|%s|%s", cfg.GetProtocol(), strings.ToLower(cfg.GetServer()), cfg.GetPort(), secret, transport)
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:8])
+}
+
+// transportKey joins the transport fields Fingerprint hashes. Spellings that
+// mean the same connection (no type vs type=tcp, security=none vs none given)
+// are normalized so they don't split one server into two.
+func transportKey(network, security, host, path, sni, flow, publicKey, shortID string) string {
+	network = strings.ToLower(network)
+	if network == "" {
+		network = "tcp"
+	}
+	security = strings.ToLower(security)
+	if security == "none" {
+		security = ""
+	}
+	return strings.Join([]string{network, security, strings.ToLower(host), path,
+		strings.ToLower(sni), flow, publicKey, shortID}, "|")
+}
+
+func parseSocks(raw string) (*SocksConfig, error) {
+	raw, frag := cutFragment(raw)
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("socks parse error: %w", err)
+	}
+	host, port, err := proxyHostPort(u, "1080")
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &SocksConfig{Server: host, Port: port, Name: proxyName(frag, host, port)}
+	if u.User != nil {
+		cfg.Username = u.User.Username()
+		cfg.Password, _ = u.User.Password()
+		// v2rayN-style socks:// carries base64("user:pass") as the username
+		if _, hasPass := u.User.Password(); !hasPass {
+			if dec, err := base64DecodeUserinfo(cfg.Username); err == nil && strings.Contains(dec, ":") {
+				parts := strings.SplitN(dec, ":", 2)
+				cfg.Username, cfg.Password = parts[0], parts[1]
+			}
+		}
+	}
+	return cfg, nil
+}
+
+func parseHttp(raw string) (*HttpConfig, error) {
+	raw, frag := cutFragment(raw)
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("http parse error: %w", err)
+	}
+	// A path or query means this is a regular URL (e.g. a subscription link), not a proxy.
+	if (u.Path != "" && u.Path != "/") || u.RawQuery != "" {
+		return nil, fmt.Errorf("not a proxy URI: %s", raw)
+	}
+	if u.Port() == "" {
+		return nil, fmt.Errorf("http proxy requires an explicit port: %s", raw)
+	}
+	host, port, err := proxyHostPort(u, "")
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &HttpConfig{Server: host, Port: port, TLS: u.Scheme == "https", Name: proxyName(frag, host, port)}
+	if u.User != nil {
+		cfg.Username = u.User.Username()
+		cfg.Password, _ = u.User.Password()
+	}
+	return cfg, nil
+}
+
+// proxyHostPort extracts host and port from a plain proxy URL, using defaultPort when absent.
+func proxyHostPort(u *url.URL, defaultPort string) (string, int, error) {
+	portStr := u.Port()
+	if portStr == "" {
+		portStr = defaultPort
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid port: %w", err)
+	}
+	return u.Hostname(), port, nil
+}
+
+// proxyName returns the decoded fragment, or host:port when there is none.
+func proxyName(frag, host string, port int) string {
+	if name := decodeName(frag); name != "" {
+		return name
+	}
+	return fmt.Sprintf("%s:%d", host, port)
+}
+
+// cutFragment splits the raw #name off a share URI before url.Parse sees it,
+// so a stray '%' in a name ("100%") can't fail the whole config.
+func cutFragment(raw string) (string, string) {
+	rest, frag, _ := strings.Cut(raw, "#")
+	return rest, frag
+}
+
+// decodeName turns a raw URI fragment into a display name. Names are
+// percent-decoded, a second time only when the first pass leaves escaped
+// multi-byte UTF-8 behind (double-encoded %25F0%259F...), so a literal
+// "%2541" stays "%41". '+' reads as a space only in names with no
+// percent-escapes at all; next to escapes it is a literal plus. A name that
+// does not decode to valid UTF-8 is returned as-is.
+func decodeName(frag string) string {
+	name := frag
+	if !strings.Contains(name, "%") {
+		return strings.TrimSpace(strings.ReplaceAll(name, "+", " "))
+	}
+	dec, err := url.PathUnescape(name)
+	if err != nil || !utf8.ValidString(dec) {
+		return frag
+	}
+	name = dec
+	if hasEscapedMultibyte(name) {
+		if dec, err := url.PathUnescape(name); err == nil && utf8.ValidString(dec) {
 			name = dec
 		}
 	}
+	return strings.TrimSpace(name)
+}
 
-	return &TrojanConfig{
-		Name:     name,
-		Password: password,
-		Server:   host,
-		Port:     port,
-		Security: security,
-		Type:     q.Get("type"),
-		SNI:      q.Get("sni"),
-		Host:     q.Get("host"),
-		Path:     q.Get("path"),
-		Fp:       q.Get("fp"),
-	}, nil
+// hasEscapedMultibyte reports whether s contains a run of %XX escapes that
+// decodes to valid UTF-8 with at least one multi-byte character.
+func hasEscapedMultibyte(s string) bool {
+	var run []byte
+	flush := func() bool {
+		ok := utf8.Valid(run) && utf8.RuneCount(run) < len(run)
+		run = run[:0]
+		return ok
+	}
+	for i := 0; i < len(s); {
+		if s[i] == '%' && i+2 < len(s) {
+			if b, err := strconv.ParseUint(s[i+1:i+3], 16, 8); err == nil {
+				run = append(run, byte(b))
+				i += 3
+				continue
+			}
+		}
+		if flush() {
+			return true
+		}
+		i++
+	}
+	return flush()
+}
+
+// lowerScheme lowercases the scheme of a URI: schemes are case-insensitive
+// and links like VLESS:// or Trojan:// turn up in pasted text.
+func lowerScheme(uri string) string {
+	if i := strings.Index(uri, "://"); i > 0 {
+		return strings.ToLower(uri[:i]) + uri[i:]
+	}
+	return uri
 }
 
 // RenameURI rewrites the display name inside a proxy URI to the given name.
-// For vless://, ss://, trojan:// it replaces the URL fragment.
+// For vless://, ss://, trojan://, trojan-go:// it replaces the URL fragment.
 // For vmess:// it re-encodes the base64 JSON with the new "ps" field.
 // Returns the original URI unchanged on any error.
 func RenameURI(rawURI, name string) string {
+	rawURI = lowerScheme(rawURI)
 	switch {
 	case strings.HasPrefix(rawURI, "vmess://"):
 		return renameVmess(rawURI, name)
 	case strings.HasPrefix(rawURI, "vless://"),
 		strings.HasPrefix(rawURI, "ss://"),
-		strings.HasPrefix(rawURI, "trojan://"):
+		strings.HasPrefix(rawURI, "trojan://"),
+		strings.HasPrefix(rawURI, "trojan-go://"),
+		strings.HasPrefix(rawURI, "socks5://"),
+		strings.HasPrefix(rawURI, "socks://"),
+		strings.HasPrefix(rawURI, "http://"),
+		strings.HasPrefix(rawURI, "https://"):
 		return renameFragment(rawURI, name)
 	}
 	return rawURI
 }
 
+// SetName changes the display name of a parsed config in place.
+func SetName(cfg ProxyConfig, name string) {
+	switch c := cfg.(type) {
+	case *VlessConfig:
+		c.Name = name
+	case *VmessConfig:
+		c.Name = name
+	case *TrojanConfig:
+		c.Name = name
+	case *SSConfig:
+		c.Name = name
+	case *SocksConfig:
+		c.Name = name
+	case *HttpConfig:
+		c.Name = name
+	}
+}
+
 // renameFragment replaces the #fragment part of a URI with url-encoded name.
 func renameFragment(rawURI, name string) string {
 	if idx := strings.IndexByte(rawURI, '#'); idx >= 0 {
 		rawURI = rawURI[:idx]
 	}
-	return rawURI + "#" + url.PathEscape(name)
+	return rawURI + "#" + escapeName(name)
 }
 
 // renameVmess decodes the vmess base64 JSON, sets ps=name, re-encodes.
@@ -364,6 +728,49 @@ func renameVmess(rawURI, name string) string {
 	return "vmess://" + base64.StdEncoding.EncodeToString(encoded)
 }
 
+// ssMethods are the ciphers recognised in plain (non-base64) SIP002 userinfo.
+var ssMethods = map[string]bool{
+	"aes-128-gcm":                   true,
+	"aes-192-gcm":                   true,
+	"aes-256-gcm":                   true,
+	"chacha20-ietf-poly1305":        true,
+	"xchacha20-ietf-poly1305":       true,
+	"chacha20-poly1305":             true,
+	"xchacha20-poly1305":            true,
+	"2022-blake3-aes-128-gcm":       true,
+	"2022-blake3-aes-256-gcm":       true,
+	"2022-blake3-chacha20-poly1305": true,
+	"aes-128-cfb":                   true,
+	"aes-256-cfb":                   true,
+	"chacha20-ietf":                 true,
+	"rc4-md5":                       true,
+	"none":                          true,
+	"plain":                         true,
+}
+
+// ssUserinfo returns [method, password] from an ss:// userinfo. SIP002 allows
+// either base64("method:password") or, typically for 2022 ciphers, a plain
+// percent-encoded method:password; the plain form is accepted only when the
+// method is a known cipher, otherwise the userinfo is decoded as base64.
+func ssUserinfo(user *url.Userinfo) ([]string, error) {
+	if user == nil {
+		return nil, fmt.Errorf("ss userinfo missing")
+	}
+	if password, ok := user.Password(); ok && ssMethods[strings.ToLower(user.Username())] {
+		return []string{user.Username(), password}, nil
+	}
+
+	decoded, err := base64DecodeUserinfo(user.String())
+	if err != nil {
+		return nil, fmt.Errorf("ss userinfo decode error: %w", err)
+	}
+	parts := strings.SplitN(decoded, ":", 2)
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("ss userinfo format invalid: %s", decoded)
+	}
+	return parts, nil
+}
+
 // base64DecodeUserinfo tries standard and URL-safe base64 decoding
 func base64DecodeUserinfo(s string) (string, error) {
 	s, _ = url.QueryUnescape(s)
@@ -389,6 +796,76 @@ func base64DecodeUserinfo(s string) (string, error) {
 	return string(b), nil
 }
 
+// defaultMuxConcurrency is used when a URI enables mux without a number.
+const defaultMuxConcurrency = 8
+
+// transportHostPath reads host and path from a vless/trojan query, folding in
+// the kcp seed and the quic security/key the way vmess share JSON carries them.
+func transportHostPath(q url.Values, rawQuery string) (host, path string) {
+	host, path = q.Get("host"), queryPath(rawQuery)
+	switch q.Get("type") {
+	case "kcp":
+		if path == "" {
+			path = q.Get("seed")
+		}
+	case "quic":
+		if host == "" {
+			host = q.Get("quicSecurity")
+		}
+		if path == "" {
+			path = q.Get("key")
+		}
+	}
+	return host, path
+}
+
+// queryPath reads the path parameter byte-for-byte (see rawQueryParam): ws
+// paths such as /ws?ed=2048 carry xray's early-data setting in their own
+// query, and a '+' in a path is literal. A path that still starts with an
+// escaped '/' was percent-encoded twice by its exporter and is decoded again.
+func queryPath(rawQuery string) string {
+	path := rawQueryParam(rawQuery, "path")
+	if strings.HasPrefix(strings.ToUpper(path), "%2F") {
+		if dec, err := url.PathUnescape(path); err == nil {
+			path = dec
+		}
+	}
+	return path
+}
+
+// parseMux interprets the mux query parameter: "1"/"true"/"on" enable mux with
+// the default concurrency, a number >1 sets the concurrency, "0"/"false"/"off"
+// disable it explicitly. Unknown or empty values leave it unset.
+func parseMux(v string) int {
+	switch strings.ToLower(v) {
+	case "":
+		return 0
+	case "1", "true", "on":
+		return defaultMuxConcurrency
+	case "0", "false", "off":
+		return -1
+	}
+	if n, err := strconv.Atoi(v); err == nil && n > 0 {
+		return n
+	}
+	return 0
+}
+
+// toBool interprets JSON booleans as well as the "1"/"true" strings and 0/1
+// numbers some clients emit instead.
+func toBool(v interface{}) bool {
+	switch x := v.(type) {
+	case bool:
+		return x
+	case float64:
+		return x != 0
+	case string:
+		b, _ := strconv.ParseBool(x)
+		return b
+	}
+	return false
+}
+
 // toInt coerces a json number/string to int
 func toInt(v interface{}) (int, error) {
 	switch x := v.(type) {
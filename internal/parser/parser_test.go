@@ -0,0 +1,255 @@
+package parser
+
+import (
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseSS(t *testing.T) {
+	b64 := func(s string) string { return base64.RawURLEncoding.EncodeToString([]byte(s)) }
+	tests := []struct {
+		name     string
+		uri      string
+		method   string
+		password string
+		server   string
+		port     int
+	}{
+		{"base64 userinfo", "ss://" + b64("aes-256-gcm:password") + "@ss.example.com:8388#n",
+			"aes-256-gcm", "password", "ss.example.com", 8388},
+		{"padded standard base64", "ss://" + base64.StdEncoding.EncodeToString([]byte("chacha20-ietf-poly1305:p@ss")) + "@ss.example.com:443#n",
+			"chacha20-ietf-poly1305", "p@ss", "ss.example.com", 443},
+		{"plain 2022", "ss://2022-blake3-aes-128-gcm:YWJjZGVmZ2hpamtsbW5vcA%3D%3D@ss.example.com:8388#n",
+			"2022-blake3-aes-128-gcm", "YWJjZGVmZ2hpamtsbW5vcA==", "ss.example.com", 8388},
+		{"plain with escaped colon in password", "ss://aes-128-gcm:a%3Ab%2Bc@ss.example.com:8388#n",
+			"aes-128-gcm", "a:b+c", "ss.example.com", 8388},
+		{"plugin", "ss://" + b64("aes-128-gcm:password") + "@ss.example.com:8388/?plugin=obfs-local%3Bobfs%3Dhttp%3Bobfs-host%3Dexample.com#n",
+			"aes-128-gcm", "password", "ss.example.com", 8388},
+		{"plain with plugin", "ss://2022-blake3-aes-256-gcm:cGFzcw%3D%3D@[2001:db8::1]:8388/?plugin=v2ray-plugin%3Bmode%3Dwebsocket#n",
+			"2022-blake3-aes-256-gcm", "cGFzcw==", "2001:db8::1", 8388},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := ParseLine(tt.uri)
+			if err != nil {
+				t.Fatal(err)
+			}
+			c, ok := cfg.(*SSConfig)
+			if !ok {
+				t.Fatalf("parsed as %T", cfg)
+			}
+			if c.Method != tt.method || c.Password != tt.password || c.Server != tt.server || c.Port != tt.port {
+				t.Errorf("got %s:%s @ %s:%d, want %s:%s @ %s:%d",
+					c.Method, c.Password, c.Server, c.Port, tt.method, tt.password, tt.server, tt.port)
+			}
+		})
+	}
+}
+
+func TestParseSSInvalid(t *testing.T) {
+	for _, uri := range []string{
+		"ss://@ss.example.com:8388",
+		"ss://not-a-cipher:password@ss.example.com:8388", // plain form needs a known method
+		"ss://" + base64.RawURLEncoding.EncodeToString([]byte("no-colon")) + "@ss.example.com:8388",
+	} {
+		if _, err := ParseLine(uri); err == nil {
+			t.Errorf("ParseLine(%q) succeeded, want an error", uri)
+		}
+	}
+}
+
+// TestParseVmessClientExports parses the vmess JSON of each client's export
+// format in testdata/vmess and checks the TLS intent it carries.
+func TestParseVmessClientExports(t *testing.T) {
+	tests := []struct {
+		file     string
+		sni      string
+		insecure bool
+		port     int
+	}{
+		{"v2rayn.json", "cdn.example.com", false, 443},
+		{"v2rayng.json", "ng.example.com", true, 443},
+		{"nekobox.json", "neko.example.com", true, 8443},
+		{"qv2ray.json", "qv.example.com", true, 443},
+		{"qv2ray-verified.json", "qv.example.com", false, 443},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			body, err := os.ReadFile(filepath.Join("testdata", "vmess", tt.file))
+			if err != nil {
+				t.Fatal(err)
+			}
+			cfg, err := ParseLine("vmess://" + base64.StdEncoding.EncodeToString(body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			c := cfg.(*VmessConfig)
+			if c.TLS != "tls" || c.SNI != tt.sni || c.AllowInsecure != tt.insecure || c.Port != tt.port {
+				t.Errorf("got tls=%q sni=%q insecure=%v port=%d, want tls sni=%q insecure=%v port=%d",
+					c.TLS, c.SNI, c.AllowInsecure, c.Port, tt.sni, tt.insecure, tt.port)
+			}
+		})
+	}
+}
+
+func TestParseTrojanGo(t *testing.T) {
+	tests := []struct {
+		name             string
+		uri              string
+		typ, host, path  string
+		ssMethod, ssPass string
+		mux              int
+	}{
+		{"ws with ss layer",
+			"trojan-go://secret@tg.example.com:443?sni=tg.example.com&type=ws&host=cdn.example.com&path=%2Ftrojan&encryption=ss%3Baes-128-gcm%3Asspass#tg",
+			"ws", "cdn.example.com", "/trojan", "aes-128-gcm", "sspass", 0},
+		{"semicolon ss form",
+			"trojan-go://secret@tg.example.com:443?type=ws&path=%2Ft&encryption=ss%3Bchacha20-ietf-poly1305%3Bp%3Aw#tg",
+			"ws", "", "/t", "chacha20-ietf-poly1305", "p:w", 0},
+		{"original", "trojan-go://secret@tg.example.com:443?type=original&sni=tg.example.com#tg",
+			"", "", "", "", "", 0},
+		{"no type, encryption none", "trojan-go://secret@tg.example.com:443?encryption=none#tg",
+			"", "", "", "", "", 0},
+		{"ws with mux", "trojan-go://secret@tg.example.com:443?type=ws&host=cdn.example.com&path=%2Fm&mux=1#tg",
+			"ws", "cdn.example.com", "/m", "", "", defaultMuxConcurrency},
+		{"mux concurrency", "trojan-go://secret@tg.example.com:443?mux=16#tg",
+			"", "", "", "", "", 16},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := ParseLine(tt.uri)
+			if err != nil {
+				t.Fatal(err)
+			}
+			c := cfg.(*TrojanConfig)
+			if !c.TrojanGo {
+				t.Error("TrojanGo not set")
+			}
+			if c.Password != "secret" || c.Server != "tg.example.com" || c.Port != 443 {
+				t.Errorf("endpoint = %s@%s:%d", c.Password, c.Server, c.Port)
+			}
+			if c.Type != tt.typ || c.Host != tt.host || c.Path != tt.path {
+				t.Errorf("transport = %q host %q path %q, want %q host %q path %q", c.Type, c.Host, c.Path, tt.typ, tt.host, tt.path)
+			}
+			if c.SSMethod != tt.ssMethod || c.SSPassword != tt.ssPass {
+				t.Errorf("ss layer = %q/%q, want %q/%q", c.SSMethod, c.SSPassword, tt.ssMethod, tt.ssPass)
+			}
+			if c.Mux != tt.mux {
+				t.Errorf("mux = %d, want %d", c.Mux, tt.mux)
+			}
+		})
+	}
+}
+
+func TestParseTrojanGoInvalid(t *testing.T) {
+	for _, uri := range []string{
+		"trojan-go://secret@tg.example.com:443?type=grpc#tg",
+		"trojan-go://secret@tg.example.com:443?encryption=ss%3B#tg",
+		"trojan-go://secret@tg.example.com:443?encryption=aes-128-gcm%3Apass#tg",
+	} {
+		if _, err := ParseLine(uri); err == nil {
+			t.Errorf("ParseLine(%q) succeeded, want an error", uri)
+		}
+	}
+}
+
+func TestParseLineSchemeCase(t *testing.T) {
+	for _, uri := range []string{
+		"VLESS://11111111-2222-3333-4444-555555555555@vless.example.com:443?security=tls#upper",
+		"Trojan://secret@trojan.example.com:443#mixed",
+		"TROJAN-GO://secret@trojan.example.com:443?type=ws#upper-go",
+		"SS://YWVzLTI1Ni1nY206cGFzc3dvcmQ@ss.example.com:8388#ss",
+		"VMess://" + base64.StdEncoding.EncodeToString([]byte(`{"v":"2","add":"vmess.example.com","port":"443","id":"11111111-2222-3333-4444-555555555555","aid":"0"}`)),
+		"SOCKS5://socks.example.com:1080",
+	} {
+		if _, err := ParseLine(uri); err != nil {
+			t.Errorf("ParseLine(%q): %v", uri, err)
+		}
+	}
+}
+
+func TestExtractedURIsParse(t *testing.T) {
+	text := `<p>Fresh: VLESS://11111111-2222-3333-4444-555555555555@vless.example.com:443?security=tls&amp;type=ws#a, and trojan://secret@trojan.example.com:443#b.</p>`
+	uris := ExtractURIs(text)
+	if len(uris) != 2 {
+		t.Fatalf("extracted %q, want 2 URIs", uris)
+	}
+	for _, uri := range uris {
+		if _, err := ParseLine(uri); err != nil {
+			t.Errorf("extracted %q does not parse: %v", uri, err)
+		}
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	const base = "vless://11111111-2222-3333-4444-555555555555@vless.example.com:443?security=tls&sni=cdn.example.com"
+	fp := func(uri string) string { return Fingerprint(mustParse(t, uri)) }
+
+	ws := fp(base + "&type=ws&host=cdn.example.com&path=%2Fws#ws")
+	grpc := fp(base + "&type=grpc&serviceName=grpc#grpc")
+	if ws == grpc {
+		t.Errorf("ws and grpc variants of one UUID share fingerprint %s", ws)
+	}
+
+	different := map[string]string{
+		"path":     base + "&type=ws&host=cdn.example.com&path=%2Fother#ws",
+		"host":     base + "&type=ws&host=other.example.com&path=%2Fws#ws",
+		"sni":      "vless://11111111-2222-3333-4444-555555555555@vless.example.com:443?security=tls&sni=other.example.com&type=ws&host=cdn.example.com&path=%2Fws#ws",
+		"security": "vless://11111111-2222-3333-4444-555555555555@vless.example.com:443?sni=cdn.example.com&type=ws&host=cdn.example.com&path=%2Fws#ws",
+	}
+	for field, uri := range different {
+		if fp(uri) == ws {
+			t.Errorf("changing %s kept fingerprint %s", field, ws)
+		}
+	}
+
+	reality := "vless://11111111-2222-3333-4444-555555555555@vless.example.com:443?security=reality&sni=www.microsoft.com&pbk=KEY1&sid=ab"
+	if fp(reality+"#a") == fp(strings.Replace(reality, "KEY1", "KEY2", 1)+"#a") {
+		t.Error("reality public key is not part of the fingerprint")
+	}
+	if fp(reality+"&flow=xtls-rprx-vision#a") == fp(reality+"#a") {
+		t.Error("flow is not part of the fingerprint")
+	}
+
+	ss := "ss://" + base64.RawURLEncoding.EncodeToString([]byte("aes-128-gcm:password")) + "@ss.example.com:8388"
+	if fp(ss+"#a") == fp(ss+"/?plugin=obfs-local%3Bobfs%3Dhttp#a") {
+		t.Error("ss plugin is not part of the fingerprint")
+	}
+
+	// The name and equivalent spellings of one connection don't matter.
+	same := [][2]string{
+		{base + "&type=ws&host=cdn.example.com&path=%2Fws#ws", base + "&type=ws&host=cdn.example.com&path=%2Fws#renamed"},
+		{reality + "#a", reality + "&type=tcp#a"},
+		{"vless://11111111-2222-3333-4444-555555555555@VLESS.example.com:443?security=none#a",
+			"vless://11111111-2222-3333-4444-555555555555@vless.example.com:443#a"},
+	}
+	for _, pair := range same {
+		if fp(pair[0]) != fp(pair[1]) {
+			t.Errorf("fingerprints differ:\n%s\n%s", pair[0], pair[1])
+		}
+	}
+}
+
+func TestDecodeName(t *testing.T) {
+	tests := []struct {
+		frag, want string
+	}{
+		{"%F0%9F%87%A9%F0%9F%87%AA%20Germany", "🇩🇪 Germany"},
+		{"%D0%93%D0%B5%D1%80%D0%BC%D0%B0%D0%BD%D0%B8%D1%8F", "Германия"},
+		{"%25F0%259F%2587%25A9%25F0%259F%2587%25AA%2520DE", "🇩🇪 DE"}, // double-encoded
+		{"A+%F0%9F%87%A9", "A+🇩"},                                    // '+' next to escapes is literal
+		{"100%2541", "100%41"},                                       // %41 is ASCII, no second pass
+		{"50%25+off", "50%+off"},
+		{"Fast+Server", "Fast Server"}, // form-encoded, no escapes
+		{"plain name", "plain name"},
+		{"bad%FFutf8", "bad%FFutf8"},
+	}
+	for _, tt := range tests {
+		if got := decodeName(tt.frag); got != tt.want {
+			t.Errorf("decodeName(%q) = %q, want %q", tt.frag, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,197 @@
+// Package singbox exports checked configs as sing-box outbounds.
+package singbox
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"vpn_checker/internal/checker"
+	"vpn_checker/internal/parser"
+)
+
+// Marshal emits the alive results as a sing-box outbounds array, ready to be
+// pasted under "outbounds" in a sing-box config. configs is the full checked
+// list: results[i].Index-1 indexes into it. Tags are the config names,
+// suffixed with " #n" when a name repeats, since sing-box requires unique
+// tags. Configs sing-box can't express (see Unsupported) are left out.
+func Marshal(results []checker.Result, configs []parser.ProxyConfig) ([]byte, error) {
+	outbounds := []map[string]interface{}{}
+	seen := make(map[string]int)
+	for _, r := range results {
+		if !r.Alive || r.Index < 1 || r.Index > len(configs) {
+			continue
+		}
+		cfg := configs[r.Index-1]
+		ob, err := convert(cfg)
+		if err != nil {
+			continue
+		}
+		tag := cfg.GetName()
+		if n := seen[tag]; n > 0 {
+			tag = fmt.Sprintf("%s #%d", tag, n+1)
+		}
+		seen[cfg.GetName()]++
+		ob["tag"] = tag
+		outbounds = append(outbounds, ob)
+	}
+	data, err := json.MarshalIndent(outbounds, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("singbox json: %w", err)
+	}
+	return data, nil
+}
+
+// Unsupported reports why cfg has no sing-box equivalent, or nil when Marshal
+// can export it. Callers use it to warn about configs Marshal leaves out.
+func Unsupported(cfg parser.ProxyConfig) error {
+	_, err := convert(cfg)
+	return err
+}
+
+// convert maps a ProxyConfig to a sing-box outbound (without tag).
+func convert(cfg parser.ProxyConfig) (map[string]interface{}, error) {
+	switch c := cfg.(type) {
+	case *parser.VlessConfig:
+		if c.Encryption != "" && c.Encryption != "none" {
+			return nil, fmt.Errorf("vless encryption %q not supported", c.Encryption)
+		}
+		ob := endpoint("vless", c.Server, c.Port)
+		ob["uuid"] = c.UUID
+		if c.Flow != "" {
+			ob["flow"] = c.Flow
+		}
+		return withStream(ob, stream{
+			network: c.Type, security: c.Security, sni: c.SNI, host: c.Host, path: c.Path,
+			fp: c.Fp, headerType: c.HeaderType, publicKey: c.PublicKey, shortID: c.ShortID,
+		})
+	case *parser.VmessConfig:
+		ob := endpoint("vmess", c.Server, c.Port)
+		ob["uuid"] = c.UUID
+		ob["alter_id"] = c.Aid
+		ob["security"] = c.Security
+		security := ""
+		if c.TLS == "tls" || c.TLS == "reality" {
+			security = c.TLS
+		}
+		return withStream(ob, stream{
+			network: c.Network, security: security, sni: c.SNI, host: c.Host, path: c.Path,
+			fp: c.Fp, headerType: c.HeaderType, publicKey: c.PublicKey, shortID: c.ShortID,
+			insecure: c.AllowInsecure,
+		})
+	case *parser.TrojanConfig:
+		if c.SSMethod != "" {
+			return nil, fmt.Errorf("trojan-go encryption ss;%s is not supported by sing-box", c.SSMethod)
+		}
+		ob := endpoint("trojan", c.Server, c.Port)
+		ob["password"] = c.Password
+		security := c.Security
+		if security == "" {
+			security = "tls"
+		}
+		return withStream(ob, stream{
+			network: c.Type, security: security, sni: c.SNI, host: c.Host, path: c.Path,
+			fp: c.Fp, headerType: c.HeaderType, publicKey: c.PublicKey, shortID: c.ShortID,
+		})
+	case *parser.SSConfig:
+		ob := endpoint("shadowsocks", c.Server, c.Port)
+		ob["method"] = c.Method
+		ob["password"] = c.Password
+		return ob, nil
+	case *parser.SocksConfig:
+		ob := endpoint("socks", c.Server, c.Port)
+		ob["version"] = "5"
+		setCredentials(ob, c.Username, c.Password)
+		return ob, nil
+	case *parser.HttpConfig:
+		ob := endpoint("http", c.Server, c.Port)
+		setCredentials(ob, c.Username, c.Password)
+		if c.TLS {
+			ob["tls"] = map[string]interface{}{"enabled": true, "server_name": c.Server}
+		}
+		return ob, nil
+	}
+	return nil, fmt.Errorf("unsupported config type %T", cfg)
+}
+
+func endpoint(typ, server string, port int) map[string]interface{} {
+	return map[string]interface{}{
+		"type":        typ,
+		"server":      server,
+		"server_port": port,
+	}
+}
+
+func setCredentials(ob map[string]interface{}, username, password string) {
+	if username != "" {
+		ob["username"] = username
+	}
+	if password != "" {
+		ob["password"] = password
+	}
+}
+
+// stream holds the transport and TLS fields shared by vless, vmess and trojan.
+type stream struct {
+	network, security, sni, host, path, fp, headerType string
+	publicKey, shortID                                 string
+	insecure                                           bool
+}
+
+// withStream adds the tls and transport blocks. sing-box has no equivalent of
+// xray's tcp http header obfuscation, kcp or xhttp, so those are rejected.
+func withStream(ob map[string]interface{}, s stream) (map[string]interface{}, error) {
+	switch s.security {
+	case "tls", "reality":
+		tls := map[string]interface{}{"enabled": true}
+		if s.sni != "" {
+			tls["server_name"] = s.sni
+		}
+		if s.insecure {
+			tls["insecure"] = true
+		}
+		fp := s.fp
+		if s.security == "reality" {
+			tls["reality"] = map[string]interface{}{
+				"enabled":    true,
+				"public_key": s.publicKey,
+				"short_id":   s.shortID,
+			}
+			if fp == "" {
+				fp = "chrome" // sing-box requires uTLS for reality
+			}
+		}
+		if fp != "" {
+			tls["utls"] = map[string]interface{}{"enabled": true, "fingerprint": fp}
+		}
+		ob["tls"] = tls
+	case "", "none":
+	default:
+		return nil, fmt.Errorf("security %q not supported", s.security)
+	}
+
+	switch s.network {
+	case "", "tcp":
+		if s.headerType == "http" {
+			return nil, fmt.Errorf("tcp http header obfuscation not supported")
+		}
+	case "ws":
+		ws := map[string]interface{}{"type": "ws", "path": s.path}
+		if s.host != "" {
+			ws["headers"] = map[string]string{"Host": s.host}
+		}
+		ob["transport"] = ws
+	case "grpc":
+		ob["transport"] = map[string]interface{}{"type": "grpc", "service_name": s.path}
+	case "http", "h2":
+		h := map[string]interface{}{"type": "http", "path": s.path}
+		if s.host != "" {
+			h["host"] = []string{s.host}
+		}
+		ob["transport"] = h
+	case "httpupgrade":
+		ob["transport"] = map[string]interface{}{"type": "httpupgrade", "host": s.host, "path": s.path}
+	default:
+		return nil, fmt.Errorf("transport %q not supported", s.network)
+	}
+	return ob, nil
+}
@@ -0,0 +1,230 @@
+package web
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"vpn_checker/internal/checker"
+	"vpn_checker/internal/input"
+	"vpn_checker/internal/parser"
+)
+
+// maxAPIBody caps a config list POSTed to /api/checks.
+const maxAPIBody = 16 << 20
+
+// controlAPI is the state behind the /api/checks endpoints: at most one run
+// at a time, kept after it finishes so its results can be fetched.
+type controlAPI struct {
+	workers int
+	timeout time.Duration
+	token   string // required as "Authorization: Bearer <token>" when set
+
+	mu   sync.Mutex
+	run  *checker.Run
+	uris []string // raw URI of each config of run, by index
+}
+
+// EnableAPI turns on the REST control API under /api/checks, which lets a
+// separate frontend submit config lists and poll the check remotely:
+//
+//	POST   /api/checks          start a check of the URI list / base64 subscription in the body
+//	GET    /api/checks          progress of the current or last check
+//	GET    /api/checks/results  its results (409 while still running)
+//	DELETE /api/checks          stop the running check
+//
+// workers and timeout are the defaults, overridable per POST with
+// ?workers= and ?timeout=. Every other check option (checker.SpeedTest,
+// CheckIPv6, ExtraTargets, ...) is a package variable the CLI set at
+// startup, so all runs share it. When token is set, requests must carry it
+// as a bearer token; without one Serve refuses non-loopback addresses.
+// Browser requests from other origins are rejected either way. Must be
+// called before Serve.
+func (s *Server) EnableAPI(workers int, timeout time.Duration, token string) {
+	s.api = &controlAPI{workers: workers, timeout: timeout, token: token}
+}
+
+// apiAuth wraps an /api/checks handler with the origin and token checks. A
+// page on another site can POST to a loopback server without a CORS
+// preflight, so a cross-origin Origin header is refused even without a token.
+func (s *Server) apiAuth(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if origin := r.Header.Get("Origin"); origin != "" {
+			if u, err := url.Parse(origin); err != nil || u.Host != r.Host {
+				http.Error(w, "cross-origin requests are not allowed", http.StatusForbidden)
+				return
+			}
+		}
+		if token := s.api.token; token != "" {
+			got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !ok || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="api"`)
+				http.Error(w, "missing or wrong bearer token", http.StatusUnauthorized)
+				return
+			}
+		}
+		h(w, r)
+	}
+}
+
+// loopbackAddr reports whether a listen address only accepts local
+// connections; ":8080" listens on every interface.
+func loopbackAddr(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// apiStartResponse answers a POST /api/checks.
+type apiStartResponse struct {
+	Total   int `json:"total"`
+	Skipped int `json:"skipped"` // lines that did not parse as configs
+}
+
+func (s *Server) handleAPIStart(w http.ResponseWriter, r *http.Request) {
+	workers, timeout := s.api.workers, s.api.timeout
+	if v := r.URL.Query().Get("workers"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			http.Error(w, "bad workers: "+v, http.StatusBadRequest)
+			return
+		}
+		workers = n
+	}
+	if v := r.URL.Query().Get("timeout"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			http.Error(w, "bad timeout: "+v, http.StatusBadRequest)
+			return
+		}
+		timeout = d
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxAPIBody))
+	if err != nil {
+		http.Error(w, "read body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	configs, uris, skipped := parseConfigList(body)
+	if len(configs) == 0 {
+		http.Error(w, "no valid configs in body", http.StatusBadRequest)
+		return
+	}
+
+	s.api.mu.Lock()
+	if s.api.run != nil && s.api.run.Progress().Running {
+		s.api.mu.Unlock()
+		http.Error(w, "a check is already running", http.StatusConflict)
+		return
+	}
+	s.UpdateEntries(nil, "")
+	s.SetChecking(len(configs))
+	run := checker.StartRun(configs, workers, timeout, func(res checker.Result, done, total int) {
+		s.PublishResult(AliveEntry{Result: res, RawURI: uris[res.Index-1]}, done, total)
+	})
+	s.api.run, s.api.uris = run, uris
+	s.api.mu.Unlock()
+
+	go func() {
+		run.Wait()
+		s.api.mu.Lock()
+		defer s.api.mu.Unlock()
+		if s.api.run == run { // not superseded by a newer run meanwhile
+			s.SetDone()
+		}
+	}()
+
+	writeJSON(w, http.StatusAccepted, apiStartResponse{Total: len(configs), Skipped: skipped})
+}
+
+// parseConfigList parses a URI list or base64 subscription, one config per
+// line, returning the configs with their raw URIs and the number of lines
+// that failed to parse (blank and comment lines don't count).
+func parseConfigList(body []byte) (configs []parser.ProxyConfig, uris []string, skipped int) {
+	text := string(body)
+	if input.Detect(body) == input.Base64 {
+		text, _ = input.DecodeBase64(text)
+	}
+	sc := bufio.NewScanner(strings.NewReader(text))
+	sc.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+	for sc.Scan() {
+		uri := strings.TrimSpace(sc.Text())
+		cfg, err := parser.ParseLine(uri)
+		if errors.Is(err, parser.ErrCommentOrBlank) {
+			continue
+		}
+		if err != nil {
+			skipped++
+			continue
+		}
+		configs = append(configs, cfg)
+		uris = append(uris, uri)
+	}
+	return configs, uris, skipped
+}
+
+func (s *Server) handleAPIStatus(w http.ResponseWriter, r *http.Request) {
+	s.api.mu.Lock()
+	run := s.api.run
+	s.api.mu.Unlock()
+	if run == nil {
+		writeJSON(w, http.StatusOK, checker.RunProgress{})
+		return
+	}
+	writeJSON(w, http.StatusOK, run.Progress())
+}
+
+func (s *Server) handleAPIResults(w http.ResponseWriter, r *http.Request) {
+	s.api.mu.Lock()
+	run, uris := s.api.run, s.api.uris
+	s.api.mu.Unlock()
+	if run == nil {
+		http.Error(w, "no check has been started", http.StatusNotFound)
+		return
+	}
+	results, ok := run.Results()
+	if !ok {
+		p := run.Progress()
+		http.Error(w, fmt.Sprintf("check still running (%d/%d)", p.Done, p.Total), http.StatusConflict)
+		return
+	}
+	entries := make([]AliveEntry, len(results))
+	for i, res := range results {
+		entries[i] = AliveEntry{Result: res, RawURI: uris[res.Index-1]}
+	}
+	writeJSON(w, http.StatusOK, entries)
+}
+
+func (s *Server) handleAPIStop(w http.ResponseWriter, r *http.Request) {
+	s.api.mu.Lock()
+	run := s.api.run
+	s.api.mu.Unlock()
+	if run == nil || !run.Progress().Running {
+		http.Error(w, "no check is running", http.StatusNotFound)
+		return
+	}
+	run.Stop()
+	writeJSON(w, http.StatusOK, run.Progress())
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
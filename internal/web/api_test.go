@@ -0,0 +1,68 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestServeRefusesOpenAPI(t *testing.T) {
+	s := NewServer(nil)
+	s.EnableAPI(1, time.Second, "")
+	err := s.Serve(":0")
+	if err == nil || !strings.Contains(err.Error(), "token") {
+		t.Errorf("Serve on all interfaces without a token: err = %v, want a refusal", err)
+	}
+}
+
+func TestAPIAuth(t *testing.T) {
+	for _, addr := range []string{"127.0.0.1:8080", "[::1]:8080", "localhost:8080"} {
+		if !loopbackAddr(addr) {
+			t.Errorf("%s: not treated as loopback", addr)
+		}
+	}
+	for _, addr := range []string{":8080", "0.0.0.0:8080", "192.0.2.1:8080"} {
+		if loopbackAddr(addr) {
+			t.Errorf("%s: treated as loopback", addr)
+		}
+	}
+
+	s := NewServer(nil)
+	s.EnableAPI(1, time.Second, "s3cret")
+	ts := httptest.NewServer(s.handler())
+	defer ts.Close()
+
+	tests := []struct {
+		name   string
+		auth   string
+		origin string
+		want   int
+	}{
+		{"no token", "", "", http.StatusUnauthorized},
+		{"wrong token", "Bearer nope", "", http.StatusUnauthorized},
+		{"token", "Bearer s3cret", "", http.StatusOK},
+		{"same origin", "Bearer s3cret", ts.URL, http.StatusOK},
+		{"cross origin", "Bearer s3cret", "https://evil.example", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest("GET", ts.URL+"/api/checks", nil)
+			if tt.auth != "" {
+				req.Header.Set("Authorization", tt.auth)
+			}
+			if tt.origin != "" {
+				req.Header.Set("Origin", tt.origin)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.want {
+				t.Errorf("status %d, want %d", resp.StatusCode, tt.want)
+			}
+		})
+	}
+}
@@ -1,9 +1,11 @@
 package web
 
 import (
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -19,7 +21,7 @@ type AliveEntry struct {
 
 // CheckEvent is sent over SSE for each finished config check.
 type CheckEvent struct {
-	Type    string     `json:"type"` // "result" | "done" | "remove"
+	Type    string     `json:"type"` // "result" | "update" | "done" | "remove"
 	Alive   bool       `json:"alive,omitempty"`
 	Entry   *AliveEntry `json:"entry,omitempty"`
 	Key     string     `json:"key,omitempty"` // for "remove"
@@ -45,8 +47,22 @@ type Server struct {
 	// SSE broker
 	sseClients map[chan []byte]struct{}
 	sseMu      sync.Mutex
+
+	// default ordering for /events snapshots and /configs when the request
+	// has no ?sort= (empty = check order)
+	sortKey   string
+	sortOrder string
+
+	// showDead keeps failed results in the list (-serve-all)
+	showDead bool
+
+	// api is the /api/checks control API, nil unless EnableAPI was called
+	api *controlAPI
 }
 
+// SortKeys lists the fields accepted by ?sort= and SetDefaultSort.
+var SortKeys = []string{"latency", "name", "country", "protocol", "score"}
+
 // NewServer creates a Server ready to serve (entries may be empty initially).
 func NewServer(entries []AliveEntry) *Server {
 	return &Server{
@@ -58,6 +74,29 @@ func NewServer(entries []AliveEntry) *Server {
 	}
 }
 
+// SetDefaultSort sets the ordering used when a request has no ?sort=.
+// order is "asc" or "desc" ("" = asc).
+func (s *Server) SetDefaultSort(key, order string) error {
+	if !validSortKey(key) {
+		return fmt.Errorf("unsupported sort key %q (supported: %s)", key, strings.Join(SortKeys, ", "))
+	}
+	if order != "" && order != "asc" && order != "desc" {
+		return fmt.Errorf("unsupported sort order %q (supported: asc, desc)", order)
+	}
+	s.mu.Lock()
+	s.sortKey, s.sortOrder = key, order
+	s.mu.Unlock()
+	return nil
+}
+
+// SetShowDead makes PublishResult keep dead results too, so the page lists
+// them with their errors. /configs still serves alive entries only.
+func (s *Server) SetShowDead(show bool) {
+	s.mu.Lock()
+	s.showDead = show
+	s.mu.Unlock()
+}
+
 // ---- state mutations ----
 
 // SetChecking marks the server as "check in progress" with a known total.
@@ -80,23 +119,15 @@ func (s *Server) SetDone() {
 
 // PublishResult is called after each individual config check.
 // If alive, it appends to the list and broadcasts an SSE "result" event.
-// If dead, it broadcasts a "result" event with Alive=false (no entry added).
+// If dead, it broadcasts a "result" event with Alive=false (no entry added,
+// unless SetShowDead is on).
 func (s *Server) PublishResult(e AliveEntry, done, total int) {
 	s.mu.Lock()
 	s.state.Done = done
 	s.state.Total = total
-	if e.Result.Alive {
-		key := entryKey(e)
-		found := false
-		for _, ex := range s.state.Entries {
-			if entryKey(ex) == key {
-				found = true
-				break
-			}
-		}
-		if !found {
-			s.state.Entries = append(s.state.Entries, e)
-		}
+	keep := e.Result.Alive || s.showDead
+	if keep {
+		s.state.Entries = upsertEntry(s.state.Entries, e)
 	}
 	s.mu.Unlock()
 
@@ -106,7 +137,7 @@ func (s *Server) PublishResult(e AliveEntry, done, total int) {
 		Done:  done,
 		Total: total,
 	}
-	if e.Result.Alive {
+	if keep {
 		ev.Entry = &e
 	}
 	s.broadcast(ev)
@@ -128,14 +159,17 @@ func (s *Server) AppendEntries(newEntries []AliveEntry, nextCheckIn string) {
 	s.mu.Lock()
 	seen := make(map[string]struct{}, len(s.state.Entries))
 	for _, e := range s.state.Entries {
-		seen[entryKey(e)] = struct{}{}
+		seen[EntryKey(e)] = struct{}{}
 	}
 	merged := s.state.Entries
 	for _, e := range newEntries {
-		k := entryKey(e)
+		k := EntryKey(e)
 		if _, exists := seen[k]; !exists {
 			seen[k] = struct{}{}
 			merged = append(merged, e)
+		} else if e.Result.Alive {
+			// a listed dead entry (-serve-all) came back alive
+			merged = upsertEntry(merged, e)
 		}
 	}
 	s.state.Entries = merged
@@ -160,12 +194,33 @@ func (s *Server) Entries() []AliveEntry {
 	return cp
 }
 
+// RefreshEntry replaces an entry with a re-checked result (matched by key)
+// and broadcasts an SSE "update" event, so open pages show the new latency
+// without a reload. Unlike PublishResult it leaves the progress counters alone.
+func (s *Server) RefreshEntry(e AliveEntry) {
+	key := EntryKey(e)
+	found := false
+	s.mu.Lock()
+	for i, ex := range s.state.Entries {
+		if EntryKey(ex) == key {
+			s.state.Entries[i] = e
+			found = true
+			break
+		}
+	}
+	s.mu.Unlock()
+	if !found {
+		return // removed meanwhile
+	}
+	s.broadcast(CheckEvent{Type: "update", Alive: e.Result.Alive, Entry: &e})
+}
+
 // RemoveEntry removes the entry with the given key and broadcasts an SSE "remove" event.
 func (s *Server) RemoveEntry(key string) {
 	s.mu.Lock()
 	out := s.state.Entries[:0]
 	for _, e := range s.state.Entries {
-		if entryKey(e) != key {
+		if EntryKey(e) != key {
 			out = append(out, e)
 		}
 	}
@@ -174,7 +229,81 @@ func (s *Server) RemoveEntry(key string) {
 	s.broadcast(CheckEvent{Type: "remove", Key: key})
 }
 
-func entryKey(e AliveEntry) string {
+// sortedSnapshot returns a copy of the alive entries ordered per the request's
+// ?sort=&order= (falling back to the server default). Sorting a copy keeps
+// concurrent requests with different orderings from racing.
+func (s *Server) sortedSnapshot(r *http.Request) (state, []AliveEntry) {
+	s.mu.RLock()
+	st := s.state
+	entries := make([]AliveEntry, len(st.Entries))
+	copy(entries, st.Entries)
+	key, order := s.sortKey, s.sortOrder
+	s.mu.RUnlock()
+
+	if q := r.URL.Query().Get("sort"); validSortKey(q) {
+		key, order = q, r.URL.Query().Get("order")
+	}
+	sortEntries(entries, key, order == "desc")
+	return st, entries
+}
+
+// sortEntries orders entries in place by key; an empty or unknown key keeps
+// check order. The sort is stable so ties stay in check order.
+func sortEntries(entries []AliveEntry, key string, desc bool) {
+	var less func(a, b checker.Result) bool
+	switch key {
+	case "latency":
+		less = func(a, b checker.Result) bool { return a.Latency < b.Latency }
+	case "name":
+		less = func(a, b checker.Result) bool { return strings.ToLower(a.Name) < strings.ToLower(b.Name) }
+	case "country":
+		less = func(a, b checker.Result) bool { return a.Country < b.Country }
+	case "protocol":
+		less = func(a, b checker.Result) bool { return a.Protocol < b.Protocol }
+	case "score":
+		less = func(a, b checker.Result) bool { return a.Score < b.Score }
+	default:
+		return
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		if desc {
+			return less(entries[j].Result, entries[i].Result)
+		}
+		return less(entries[i].Result, entries[j].Result)
+	})
+}
+
+func validSortKey(key string) bool {
+	for _, k := range SortKeys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+// upsertEntry appends e, or replaces the entry with the same key when that
+// one is dead — an alive result always wins over a listed failure.
+func upsertEntry(entries []AliveEntry, e AliveEntry) []AliveEntry {
+	key := EntryKey(e)
+	for i, ex := range entries {
+		if EntryKey(ex) == key {
+			if !ex.Result.Alive {
+				entries[i] = e
+			}
+			return entries
+		}
+	}
+	return append(entries, e)
+}
+
+// EntryKey identifies an entry across checks; RemoveEntry takes this key.
+// The fingerprint comes first because the URI's name part may change between
+// runs (-name-template).
+func EntryKey(e AliveEntry) string {
+	if e.Result.Fingerprint != "" {
+		return e.Result.Fingerprint
+	}
 	if e.RawURI != "" {
 		return e.RawURI
 	}
@@ -223,11 +352,9 @@ func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
 	}()
 
 	// Send current state immediately so late-joiners catch up.
-	s.mu.RLock()
-	st := s.state
-	s.mu.RUnlock()
-	for _, e := range st.Entries {
-		ev := CheckEvent{Type: "result", Alive: true, Entry: &e, Done: st.Done, Total: st.Total}
+	st, entries := s.sortedSnapshot(r)
+	for _, e := range entries {
+		ev := CheckEvent{Type: "result", Alive: e.Result.Alive, Entry: &e, Done: st.Done, Total: st.Total}
 		if data, err := json.Marshal(ev); err == nil {
 			fmt.Fprintf(w, "data: %s\n\n", data)
 		}
@@ -256,13 +383,30 @@ func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
 
 // ---- HTTP server ----
 
-// Serve starts an HTTP server on addr and blocks until it exits.
+// Serve starts an HTTP server on addr and blocks until it exits. With the
+// control API enabled but no token it only listens on loopback addresses.
 func (s *Server) Serve(addr string) error {
+	if s.api != nil && s.api.token == "" && !loopbackAddr(addr) {
+		return fmt.Errorf("control API on %s would be open to other hosts: set a token (-api-token) or listen on 127.0.0.1", addr)
+	}
+	return http.ListenAndServe(addr, s.handler())
+}
+
+// handler routes the page, feeds and, if enabled, the control API.
+func (s *Server) handler() http.Handler {
 	mux := http.NewServeMux()
 	mux.HandleFunc("/", s.handleIndex)
 	mux.HandleFunc("/configs", s.handleConfigs)
+	mux.HandleFunc("/sub", s.handleSub)
+	mux.HandleFunc("/sub/{country}", s.handleSub)
 	mux.HandleFunc("/events", s.handleEvents)
-	return http.ListenAndServe(addr, mux)
+	if s.api != nil {
+		mux.HandleFunc("POST /api/checks", s.apiAuth(s.handleAPIStart))
+		mux.HandleFunc("GET /api/checks", s.apiAuth(s.handleAPIStatus))
+		mux.HandleFunc("DELETE /api/checks", s.apiAuth(s.handleAPIStop))
+		mux.HandleFunc("GET /api/checks/results", s.apiAuth(s.handleAPIResults))
+	}
+	return mux
 }
 
 // Serve is a convenience function for one-shot usage (no periodic updates).
@@ -280,20 +424,45 @@ func (s *Server) handleIndex(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *Server) handleConfigs(w http.ResponseWriter, r *http.Request) {
-	s.mu.RLock()
-	entries := s.state.Entries
-	s.mu.RUnlock()
+	_, entries := s.sortedSnapshot(r)
 
 	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
 	uris := make([]string, 0, len(entries))
 	for _, e := range entries {
-		if e.RawURI != "" {
+		if e.RawURI != "" && e.Result.Alive {
 			uris = append(uris, e.RawURI)
 		}
 	}
 	fmt.Fprint(w, strings.Join(uris, "\n"))
 }
 
+// handleSub serves the alive configs as a base64 v2rayN subscription. Under
+// /sub/{country} only configs exiting in that ISO country code are included,
+// and a country without any yields 404 so subscription clients keep their
+// last good list.
+func (s *Server) handleSub(w http.ResponseWriter, r *http.Request) {
+	country := strings.ToUpper(r.PathValue("country"))
+	_, entries := s.sortedSnapshot(r)
+
+	var uris []string
+	for _, e := range entries {
+		if e.RawURI == "" || !e.Result.Alive {
+			continue
+		}
+		if country != "" && !strings.EqualFold(e.Result.Country, country) {
+			continue
+		}
+		uris = append(uris, e.RawURI)
+	}
+	if country != "" && len(uris) == 0 {
+		http.Error(w, "no alive configs in "+country, http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprint(w, base64.StdEncoding.EncodeToString([]byte(strings.Join(uris, "\n"))))
+}
+
 const htmlPage = `<!DOCTYPE html>
 <html lang="en">
 <head>
@@ -345,7 +514,11 @@ col.c-uri{width:auto}
 .badge.shadowsocks{background:#0d3326;color:#56d364}
 .badge.vmess{background:#3a2010;color:#ffa657}
 .badge.trojan{background:#2d1a4a;color:#d2a8ff}
+.badge.cdn{background:#3a3010;color:#e3b341}
 .latency{color:#3fb950;font-variant-numeric:tabular-nums}
+tbody tr.dead-row td{color:#6e7681}
+tbody tr.dead-row .latency{color:#f85149}
+.err{color:#f85149;font-size:.72rem}
 .server{font-family:monospace;font-size:.75rem;color:#8b949e}
 .name-cell{max-width:12rem;overflow:hidden;white-space:nowrap;text-overflow:ellipsis}
 .uri-cell{overflow:hidden}
@@ -395,12 +568,21 @@ col.c-uri{width:auto}
 var rows = {}; // key -> tr element
 var allURIs = {};
 var rowCount = 0;
+var aliveCount = 0;
 
 function badgeClass(proto) {
   var m = {'vless':'vless','shadowsocks':'shadowsocks','vmess':'vmess','trojan':'trojan'};
   return m[proto] || proto;
 }
 
+// flagEmoji turns a two-letter country code into regional indicator symbols.
+function flagEmoji(cc) {
+  if (!/^[A-Za-z]{2}$/.test(cc || '')) return '';
+  return String.fromCodePoint.apply(null, cc.toUpperCase().split('').map(function(c) {
+    return 0x1F1E6 + c.charCodeAt(0) - 65;
+  }));
+}
+
 function esc(s) {
   return String(s).replace(/&/g,'&amp;').replace(/</g,'&lt;').replace(/>/g,'&gt;').replace(/"/g,'&quot;');
 }
@@ -411,25 +593,41 @@ function truncate(s, n) {
   return r.length <= n ? s : r.slice(0, n-1).join('') + '…';
 }
 
+function rowKey(entry) {
+  return entry.Result.Fingerprint || entry.RawURI || (entry.Result.Server + ':' + entry.Result.Port);
+}
+
 function addRow(entry) {
-  var key = entry.RawURI || (entry.Result.Server + ':' + entry.Result.Port);
-  if (rows[key]) return; // dedup
+  var key = rowKey(entry);
+  var r = entry.Result;
+  if (rows[key]) {
+    // a dead row (-serve-all) is replaced once the config comes back alive
+    if (!r.Alive || rows[key].dataset.alive === '1') return;
+    removeRow(key);
+  }
 
   rowCount++;
-  allURIs[key] = entry.RawURI;
+  if (r.Alive) {
+    aliveCount++;
+    allURIs[key] = entry.RawURI;
+  }
 
-  var r = entry.Result;
   var tr = document.createElement('tr');
-  tr.className = 'new-row';
+  tr.className = r.Alive ? 'new-row' : 'new-row dead-row';
   tr.dataset.key = key;
+  tr.dataset.alive = r.Alive ? '1' : '0';
+  var status = r.Alive
+    ? '<td class="latency">' + r.Latency/1000000 + 'ms</td>' +
+      '<td class="server">' + esc(r.ExitIP) + (r.IsCDN ? ' <span class="badge cdn" title="exit IP is in a CDN range">CDN</span>' : '') + '</td>' +
+      '<td>' + flagEmoji(r.Country) + ' ' + esc(r.Country) + '</td>'
+    : '<td class="latency">✘ dead</td>' +
+      '<td colspan="2" class="err" title="' + esc(r.Error) + '">' + esc(r.Error) + '</td>';
   tr.innerHTML =
     '<td>' + rowCount + '</td>' +
     '<td class="name-cell" title="' + esc(r.Name) + '">' + esc(r.Name) + '</td>' +
     '<td><span class="badge ' + badgeClass(r.Protocol) + '">' + esc(r.Protocol) + '</span></td>' +
     '<td class="server" title="' + esc(r.Server) + ':' + r.Port + '">' + esc(r.Server) + ':' + r.Port + '</td>' +
-    '<td class="latency">' + r.Latency/1000000 + 'ms</td>' +
-    '<td class="server">' + esc(r.ExitIP) + '</td>' +
-    '<td>' + esc(r.Country) + '</td>' +
+    status +
     '<td class="uri-cell"><div class="copy-row">' +
       '<span class="uri-text" title="' + esc(entry.RawURI) + '">' + esc(entry.RawURI) + '</span>' +
       '<button class="btn btn-sm" style="flex-shrink:0" onclick="copyText(' + JSON.stringify(entry.RawURI) + ')">Copy</button>' +
@@ -437,7 +635,20 @@ function addRow(entry) {
 
   document.getElementById('tbody').appendChild(tr);
   rows[key] = tr;
-  document.getElementById('aliveCount').textContent = rowCount;
+  document.getElementById('aliveCount').textContent = aliveCount;
+}
+
+// updateRow refreshes the latency of a re-checked row in place and flashes it.
+function updateRow(entry) {
+  var tr = rows[rowKey(entry)];
+  if (!tr || tr.dataset.alive !== '1') {
+    addRow(entry);
+    return;
+  }
+  tr.cells[4].textContent = entry.Result.Latency/1000000 + 'ms';
+  tr.className = '';
+  void tr.offsetWidth; // restart the new-row animation
+  tr.className = 'new-row';
 }
 
 function removeRow(key) {
@@ -447,7 +658,8 @@ function removeRow(key) {
     delete rows[key];
     delete allURIs[key];
     rowCount--;
-    document.getElementById('aliveCount').textContent = rowCount;
+    if (tr.dataset.alive === '1') aliveCount--;
+    document.getElementById('aliveCount').textContent = aliveCount;
     // Re-number
     var trs = document.querySelectorAll('#tbody tr');
     trs.forEach(function(r, i){ r.cells[0].textContent = i+1; });
@@ -455,13 +667,13 @@ function removeRow(key) {
 }
 
 function connect() {
-  var es = new EventSource('/events');
+  var es = new EventSource('/events' + location.search); // ?sort=latency&order=asc orders the snapshot
 
   es.onmessage = function(e) {
     var ev = JSON.parse(e.data);
 
     if (ev.type === 'result') {
-      if (ev.alive && ev.entry) {
+      if (ev.entry) {
         addRow(ev.entry);
       }
       if (ev.total > 0) {
@@ -477,6 +689,8 @@ function connect() {
       if (ev.checked_at) {
         document.getElementById('checkedAt').textContent = 'Last checked: ' + ev.checked_at;
       }
+    } else if (ev.type === 'update') {
+      if (ev.entry) updateRow(ev.entry);
     } else if (ev.type === 'remove') {
       removeRow(ev.key);
     }
@@ -0,0 +1,278 @@
+package xray
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	handlerService "github.com/xtls/xray-core/app/proxyman/command"
+	routerService "github.com/xtls/xray-core/app/router/command"
+	cserial "github.com/xtls/xray-core/common/serial"
+	"github.com/xtls/xray-core/core"
+	"github.com/xtls/xray-core/infra/conf/serial"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// APIRunner is a Runner that reuses an already running xray instead of
+// spawning one per check: the generated inbound, outbounds and routing rules
+// are added through xray's gRPC API (HandlerService and RoutingService) under
+// tags unique to the check, and removed again on Stop. The instance must have
+// both services enabled on Addr; no xray binary is needed locally. Its global
+// dns block is left untouched, so DNSServers has no effect in this mode.
+type APIRunner struct {
+	Addr    string        // API listen address, e.g. 127.0.0.1:10085
+	Timeout time.Duration // per API call, 5s when zero
+
+	once sync.Once
+	conn *grpc.ClientConn
+	err  error
+}
+
+// apiSeq makes tags unique across concurrent checks.
+var apiSeq atomic.Uint64
+
+// apiConfig is a generated config converted for the API: the handler and
+// rule messages xray builds from the JSON sections.
+type apiConfig struct {
+	inbounds  []*core.InboundHandlerConfig
+	outbounds []*core.OutboundHandlerConfig
+	rules     *cserial.TypedMessage // router.Config; nil without rules
+}
+
+// Start registers configJSON's inbounds, outbounds and rules with the running instance.
+func (a *APIRunner) Start(configJSON []byte) (Process, error) {
+	suffix := fmt.Sprintf("-chk%d", apiSeq.Add(1))
+	p := &apiProcess{runner: a, ruleTag: "rule" + suffix}
+	cfg, err := buildAPIConfig(configJSON, suffix, p.ruleTag)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := a.dial()
+	if err != nil {
+		return nil, err
+	}
+	handlers := handlerService.NewHandlerServiceClient(conn)
+	routing := routerService.NewRoutingServiceClient(conn)
+
+	// Outbounds first so the inbound never routes to a missing handler. Tags
+	// are recorded as they are added, so Stop only removes what exists.
+	for _, ob := range cfg.outbounds {
+		err := a.call(func(ctx context.Context) error {
+			_, err := handlers.AddOutbound(ctx, &handlerService.AddOutboundRequest{Outbound: ob})
+			return err
+		})
+		if err != nil {
+			p.Stop()
+			return nil, p.fail("add outbound "+ob.Tag, err)
+		}
+		p.outTags = append(p.outTags, ob.Tag)
+	}
+	if cfg.rules != nil {
+		err := a.call(func(ctx context.Context) error {
+			_, err := routing.AddRule(ctx, &routerService.AddRuleRequest{Config: cfg.rules, ShouldAppend: true})
+			return err
+		})
+		if err != nil {
+			p.Stop()
+			return nil, p.fail("add rules", err)
+		}
+		p.hasRules = true
+	}
+	for _, in := range cfg.inbounds {
+		err := a.call(func(ctx context.Context) error {
+			_, err := handlers.AddInbound(ctx, &handlerService.AddInboundRequest{Inbound: in})
+			return err
+		})
+		if err != nil {
+			p.Stop()
+			return nil, p.fail("add inbound "+in.Tag, err)
+		}
+		p.inTags = append(p.inTags, in.Tag)
+	}
+	return p, nil
+}
+
+// Validate builds configJSON's sections into the messages Start would send,
+// which catches the errors xray would reject them with, without contacting
+// the instance.
+func (a *APIRunner) Validate(configJSON []byte) error {
+	_, err := buildAPIConfig(configJSON, "", "")
+	return err
+}
+
+// dial connects to Addr once; the connection is shared by all checks.
+func (a *APIRunner) dial() (*grpc.ClientConn, error) {
+	a.once.Do(func() {
+		a.conn, a.err = grpc.NewClient(a.Addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+		if a.err != nil {
+			a.err = fmt.Errorf("xray api: %w", a.err)
+		}
+	})
+	return a.conn, a.err
+}
+
+// call runs one API request under the runner's timeout.
+func (a *APIRunner) call(fn func(ctx context.Context) error) error {
+	timeout := a.Timeout
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return fn(ctx)
+}
+
+// buildAPIConfig suffixes every tag in configJSON so concurrent checks don't
+// collide, tags its rules with ruleTag and builds the sections with xray's
+// own config loader.
+func buildAPIConfig(configJSON []byte, suffix, ruleTag string) (*apiConfig, error) {
+	var doc struct {
+		Inbounds  []map[string]interface{} `json:"inbounds"`
+		Outbounds []map[string]interface{} `json:"outbounds"`
+		Routing   struct {
+			Rules []map[string]interface{} `json:"rules"`
+		} `json:"routing"`
+	}
+	if err := json.Unmarshal(configJSON, &doc); err != nil {
+		return nil, fmt.Errorf("xray api: parse config: %w", err)
+	}
+
+	for _, in := range doc.Inbounds {
+		tag, _ := in["tag"].(string)
+		in["tag"] = tag + suffix
+	}
+	for _, ob := range doc.Outbounds {
+		tag, _ := ob["tag"].(string)
+		ob["tag"] = tag + suffix
+		if ss, ok := ob["streamSettings"].(map[string]interface{}); ok {
+			if so, ok := ss["sockopt"].(map[string]interface{}); ok {
+				if dp, ok := so["dialerProxy"].(string); ok {
+					so["dialerProxy"] = dp + suffix
+				}
+			}
+		}
+	}
+	var rules []map[string]interface{}
+	for _, rule := range doc.Routing.Rules {
+		tags, _ := rule["inboundTag"].([]interface{})
+		// rules keyed on the dns block's tag only make sense with our own dns block
+		if len(tags) == 1 && tags[0] == "dns-internal" {
+			continue
+		}
+		for i, t := range tags {
+			tags[i] = fmt.Sprint(t) + suffix
+		}
+		// balancerTag rules have no outboundTag and refer to the instance's balancers
+		if tag, ok := rule["outboundTag"].(string); ok {
+			rule["outboundTag"] = tag + suffix
+		}
+		rule["ruleTag"] = ruleTag
+		rules = append(rules, rule)
+	}
+
+	sections := map[string]interface{}{"inbounds": doc.Inbounds, "outbounds": doc.Outbounds}
+	if len(rules) > 0 {
+		sections["routing"] = map[string]interface{}{"rules": rules}
+	}
+	data, err := json.Marshal(sections)
+	if err != nil {
+		return nil, err
+	}
+	c, err := serial.DecodeJSONConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("xray api: %w", err)
+	}
+
+	out := &apiConfig{}
+	for _, in := range c.InboundConfigs {
+		h, err := in.Build()
+		if err != nil {
+			return nil, fmt.Errorf("xray api: inbound %s: %w", in.Tag, err)
+		}
+		out.inbounds = append(out.inbounds, h)
+	}
+	for _, ob := range c.OutboundConfigs {
+		h, err := ob.Build()
+		if err != nil {
+			return nil, fmt.Errorf("xray api: outbound %s: %w", ob.Tag, err)
+		}
+		out.outbounds = append(out.outbounds, h)
+	}
+	if c.RouterConfig != nil {
+		rc, err := c.RouterConfig.Build()
+		if err != nil {
+			return nil, fmt.Errorf("xray api: rules: %w", err)
+		}
+		out.rules = cserial.ToTypedMessage(rc)
+	}
+	return out, nil
+}
+
+type apiProcess struct {
+	runner   *APIRunner
+	inTags   []string
+	outTags  []string
+	ruleTag  string
+	hasRules bool
+
+	once sync.Once
+	mu   sync.Mutex
+	log  strings.Builder
+}
+
+// fail records a failed API call for Output and returns it as an error.
+func (p *apiProcess) fail(what string, err error) error {
+	err = fmt.Errorf("xray api: %s: %w", what, err)
+	p.mu.Lock()
+	fmt.Fprintln(&p.log, err)
+	p.mu.Unlock()
+	return err
+}
+
+// Stop removes everything Start added; failures are only logged.
+func (p *apiProcess) Stop() {
+	p.once.Do(func() {
+		conn, err := p.runner.dial()
+		if err != nil {
+			return
+		}
+		handlers := handlerService.NewHandlerServiceClient(conn)
+		routing := routerService.NewRoutingServiceClient(conn)
+		for _, tag := range p.inTags {
+			if err := p.runner.call(func(ctx context.Context) error {
+				_, err := handlers.RemoveInbound(ctx, &handlerService.RemoveInboundRequest{Tag: tag})
+				return err
+			}); err != nil {
+				_ = p.fail("remove inbound "+tag, err)
+			}
+		}
+		if p.hasRules {
+			if err := p.runner.call(func(ctx context.Context) error {
+				_, err := routing.RemoveRule(ctx, &routerService.RemoveRuleRequest{RuleTag: p.ruleTag})
+				return err
+			}); err != nil {
+				_ = p.fail("remove rules", err)
+			}
+		}
+		for _, tag := range p.outTags {
+			if err := p.runner.call(func(ctx context.Context) error {
+				_, err := handlers.RemoveOutbound(ctx, &handlerService.RemoveOutboundRequest{Tag: tag})
+				return err
+			}); err != nil {
+				_ = p.fail("remove outbound "+tag, err)
+			}
+		}
+	})
+}
+
+func (p *apiProcess) Output() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.log.String()
+}
@@ -0,0 +1,165 @@
+package xray
+
+import (
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+
+	handlerService "github.com/xtls/xray-core/app/proxyman/command"
+	"github.com/xtls/xray-core/app/router"
+	routerService "github.com/xtls/xray-core/app/router/command"
+	"google.golang.org/grpc"
+
+	"vpn_checker/internal/parser"
+)
+
+// fakeAPI records the HandlerService and RoutingService calls it receives.
+type fakeAPI struct {
+	handlerService.UnimplementedHandlerServiceServer
+	routerService.UnimplementedRoutingServiceServer
+
+	mu    sync.Mutex
+	calls []string
+	rules []*router.RoutingRule
+}
+
+func (f *fakeAPI) record(call string) {
+	f.mu.Lock()
+	f.calls = append(f.calls, call)
+	f.mu.Unlock()
+}
+
+func (f *fakeAPI) AddInbound(_ context.Context, r *handlerService.AddInboundRequest) (*handlerService.AddInboundResponse, error) {
+	f.record("adi " + r.Inbound.Tag)
+	return &handlerService.AddInboundResponse{}, nil
+}
+
+func (f *fakeAPI) RemoveInbound(_ context.Context, r *handlerService.RemoveInboundRequest) (*handlerService.RemoveInboundResponse, error) {
+	f.record("rmi " + r.Tag)
+	return &handlerService.RemoveInboundResponse{}, nil
+}
+
+func (f *fakeAPI) AddOutbound(_ context.Context, r *handlerService.AddOutboundRequest) (*handlerService.AddOutboundResponse, error) {
+	f.record("ado " + r.Outbound.Tag)
+	return &handlerService.AddOutboundResponse{}, nil
+}
+
+func (f *fakeAPI) RemoveOutbound(_ context.Context, r *handlerService.RemoveOutboundRequest) (*handlerService.RemoveOutboundResponse, error) {
+	f.record("rmo " + r.Tag)
+	return &handlerService.RemoveOutboundResponse{}, nil
+}
+
+func (f *fakeAPI) AddRule(_ context.Context, r *routerService.AddRuleRequest) (*routerService.AddRuleResponse, error) {
+	inst, err := r.Config.GetInstance()
+	if err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	f.rules = append(f.rules, inst.(*router.Config).Rule...)
+	f.mu.Unlock()
+	f.record("adrules")
+	return &routerService.AddRuleResponse{}, nil
+}
+
+func (f *fakeAPI) RemoveRule(_ context.Context, r *routerService.RemoveRuleRequest) (*routerService.RemoveRuleResponse, error) {
+	f.record("rmrules " + r.RuleTag)
+	return &routerService.RemoveRuleResponse{}, nil
+}
+
+// startFakeAPI serves a fakeAPI on a loopback port.
+func startFakeAPI(t *testing.T) (*fakeAPI, string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &fakeAPI{}
+	s := grpc.NewServer()
+	handlerService.RegisterHandlerServiceServer(s, f)
+	routerService.RegisterRoutingServiceServer(s, f)
+	go s.Serve(ln)
+	t.Cleanup(s.Stop)
+	return f, ln.Addr().String()
+}
+
+func TestAPIRunner(t *testing.T) {
+	f, addr := startFakeAPI(t)
+	cfg, err := parser.ParseLine(goldenCases[0].uri)
+	if err != nil {
+		t.Fatal(err)
+	}
+	configJSON, err := GenerateConfig(cfg, goldenSocksPort)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	runner := &APIRunner{Addr: addr}
+	if err := runner.Validate(configJSON); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	proc, err := runner.Start(configJSON)
+	if err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	proc.Stop()
+	proc.Stop() // second call is a no-op
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var adds, removes []string
+	for _, c := range f.calls {
+		op, tag, _ := strings.Cut(c, " ")
+		if tag != "" && !strings.Contains(tag, "-chk") {
+			t.Errorf("%s: tag %q has no per-check suffix", op, tag)
+		}
+		if strings.HasPrefix(op, "rm") {
+			removes = append(removes, c)
+		} else {
+			adds = append(adds, c)
+		}
+	}
+	if len(adds) == 0 || !strings.HasPrefix(adds[0], "ado ") || !strings.HasPrefix(adds[len(adds)-1], "adi ") {
+		t.Errorf("want outbounds added first and the inbound last, got %v", adds)
+	}
+	if len(removes) != len(adds) {
+		t.Errorf("Stop removed %v, Start added %v", removes, adds)
+	}
+	for _, rule := range f.rules {
+		if !strings.Contains(rule.GetTag(), "-chk") || !strings.HasPrefix(rule.GetRuleTag(), "rule-chk") {
+			t.Errorf("rule to %q tagged %q: want both suffixed", rule.GetTag(), rule.GetRuleTag())
+		}
+	}
+}
+
+// TestAPIConfigBalancerRule checks that rules without an outboundTag keep
+// their balancerTag and don't get a "<nil>" outbound.
+func TestAPIConfigBalancerRule(t *testing.T) {
+	configJSON := []byte(`{
+		"inbounds": [{"tag": "socks-in", "protocol": "socks", "listen": "127.0.0.1", "port": 10808}],
+		"outbounds": [{"tag": "proxy", "protocol": "freedom"}],
+		"routing": {"rules": [
+			{"type": "field", "inboundTag": ["socks-in"], "outboundTag": "proxy"},
+			{"type": "field", "inboundTag": ["socks-in"], "balancerTag": "pool"}
+		]}
+	}`)
+	cfg, err := buildAPIConfig(configJSON, "-chk1", "rule-chk1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	inst, err := cfg.rules.GetInstance()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rules := inst.(*router.Config).Rule
+	if len(rules) != 2 {
+		t.Fatalf("got %d rules, want 2", len(rules))
+	}
+	if got := rules[0].GetTag(); got != "proxy-chk1" {
+		t.Errorf("outbound rule targets %q, want proxy-chk1", got)
+	}
+	if got, tag := rules[1].GetBalancingTag(), rules[1].GetTag(); got != "pool" || tag != "" {
+		t.Errorf("balancer rule: balancerTag %q, outboundTag %q; want pool and none", got, tag)
+	}
+}
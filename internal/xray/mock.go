@@ -0,0 +1,144 @@
+package xray
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+)
+
+// MockRunner is a Runner that needs neither xray nor network access: instead
+// of tunnelling through the configured outbound it serves the config's SOCKS5
+// inbound itself and connects each CONNECT request with Dial. Pointing Dial at
+// local listeners lets CheckConfig run end-to-end offline.
+type MockRunner struct {
+	// Dial opens the upstream connection for a CONNECT to addr (host:port).
+	// Defaults to net.Dial.
+	Dial func(network, addr string) (net.Conn, error)
+}
+
+// Start listens on the SOCKS port found in configJSON's first inbound.
+func (m MockRunner) Start(configJSON []byte) (Process, error) {
+	var doc struct {
+		Inbounds []struct {
+			Listen string `json:"listen"`
+			Port   int    `json:"port"`
+		} `json:"inbounds"`
+	}
+	if err := json.Unmarshal(configJSON, &doc); err != nil {
+		return nil, fmt.Errorf("mock: parse config: %w", err)
+	}
+	if len(doc.Inbounds) == 0 {
+		return nil, fmt.Errorf("mock: config has no inbound")
+	}
+	in := doc.Inbounds[0]
+	ln, err := net.Listen("tcp", net.JoinHostPort(in.Listen, strconv.Itoa(in.Port)))
+	if err != nil {
+		return nil, fmt.Errorf("mock: listen: %w", err)
+	}
+
+	dial := m.Dial
+	if dial == nil {
+		dial = net.Dial
+	}
+	p := &mockProcess{ln: ln}
+	go p.serve(dial)
+	return p, nil
+}
+
+// Validate only checks that configJSON is well-formed JSON.
+func (MockRunner) Validate(configJSON []byte) error {
+	if !json.Valid(configJSON) {
+		return fmt.Errorf("mock: config is not valid JSON")
+	}
+	return nil
+}
+
+type mockProcess struct {
+	ln   net.Listener
+	once sync.Once
+}
+
+func (p *mockProcess) Stop()          { p.once.Do(func() { p.ln.Close() }) }
+func (p *mockProcess) Output() string { return "" }
+
+func (p *mockProcess) serve(dial func(network, addr string) (net.Conn, error)) {
+	for {
+		conn, err := p.ln.Accept()
+		if err != nil {
+			return
+		}
+		go handleSOCKS(conn, dial)
+	}
+}
+
+// handleSOCKS implements the no-auth CONNECT subset of SOCKS5 (RFC 1928).
+func handleSOCKS(conn net.Conn, dial func(network, addr string) (net.Conn, error)) {
+	defer conn.Close()
+
+	// greeting: VER NMETHODS METHODS...
+	hdr := make([]byte, 2)
+	if _, err := io.ReadFull(conn, hdr); err != nil || hdr[0] != 5 {
+		return
+	}
+	if _, err := io.ReadFull(conn, make([]byte, hdr[1])); err != nil {
+		return
+	}
+	if _, err := conn.Write([]byte{5, 0}); err != nil {
+		return
+	}
+
+	// request: VER CMD RSV ATYP DST.ADDR DST.PORT
+	req := make([]byte, 4)
+	if _, err := io.ReadFull(conn, req); err != nil || req[1] != 1 {
+		return
+	}
+	var host string
+	switch req[3] {
+	case 1, 4: // IPv4, IPv6
+		ip := make([]byte, net.IPv4len)
+		if req[3] == 4 {
+			ip = make([]byte, net.IPv6len)
+		}
+		if _, err := io.ReadFull(conn, ip); err != nil {
+			return
+		}
+		host = net.IP(ip).String()
+	case 3: // domain
+		n := make([]byte, 1)
+		if _, err := io.ReadFull(conn, n); err != nil {
+			return
+		}
+		name := make([]byte, n[0])
+		if _, err := io.ReadFull(conn, name); err != nil {
+			return
+		}
+		host = string(name)
+	default:
+		return
+	}
+	portBuf := make([]byte, 2)
+	if _, err := io.ReadFull(conn, portBuf); err != nil {
+		return
+	}
+	addr := net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(portBuf))))
+
+	upstream, err := dial("tcp", addr)
+	if err != nil {
+		conn.Write([]byte{5, 5, 0, 1, 0, 0, 0, 0, 0, 0}) // connection refused
+		return
+	}
+	defer upstream.Close()
+	if _, err := conn.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0}); err != nil {
+		return
+	}
+
+	go func() {
+		_, _ = io.Copy(upstream, conn)
+		upstream.Close()
+	}()
+	_, _ = io.Copy(conn, upstream)
+}
@@ -0,0 +1,44 @@
+package xray
+
+import "os/exec"
+
+// Process is a running proxy backend started by a Runner.
+type Process interface {
+	// Stop terminates the process; it is safe to call more than once.
+	Stop()
+	// Output returns what the process has logged (see LogLevel).
+	Output() string
+}
+
+// Runner starts a backend for a generated xray config. The checker talks to
+// it only through the SOCKS5 inbound the config declares, so any Runner that
+// serves that port can stand in for xray.
+type Runner interface {
+	Start(configJSON []byte) (Process, error)
+	// Validate checks configJSON without starting a long-lived process.
+	Validate(configJSON []byte) error
+}
+
+// ExecRunner runs the real xray binary from PATH.
+type ExecRunner struct{}
+
+// Start launches xray with configJSON (see the package-level Start).
+func (ExecRunner) Start(configJSON []byte) (Process, error) {
+	cmd, err := Start(configJSON)
+	if err != nil {
+		return nil, err
+	}
+	return execProcess{cmd: cmd}, nil
+}
+
+// Validate runs xray's config test mode (see the package-level Validate).
+func (ExecRunner) Validate(configJSON []byte) error {
+	return Validate(configJSON)
+}
+
+type execProcess struct {
+	cmd *exec.Cmd
+}
+
+func (p execProcess) Stop()          { Stop(p.cmd) }
+func (p execProcess) Output() string { return Output(p.cmd) }
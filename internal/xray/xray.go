@@ -5,41 +5,330 @@ import (
 	"fmt"
 	"io"
 	"os/exec"
+	"strings"
+	"sync"
 
 	"vpn_checker/internal/parser"
 )
 
+// Front, when non-nil, is a relay config that every generated outbound dials
+// through (front proxy → config under test). The exit is still the tested config.
+var Front parser.ProxyConfig
+
+// DNSServers, when set, adds a dns block so server hostnames are resolved by
+// xray's own resolver (e.g. 1.1.1.1, https://dns.google/dns-query) instead of
+// the possibly tampered system resolver.
+var DNSServers []string
+
+// MuxConcurrency enables mux with this concurrency on every outbound whose
+// URI does not say otherwise (0 = off unless the URI enables it).
+var MuxConcurrency int
+
+// ListenAddr is the address the SOCKS inbound binds to. The checker dials the
+// same address, so change it only to an interface reachable from both sides.
+var ListenAddr = "127.0.0.1"
+
+// DefaultFingerprint is the uTLS fingerprint used for reality outbounds whose
+// URI has no fp; some reality servers reject clients without one ("" = none).
+var DefaultFingerprint string
+
+// Insecure turns off TLS certificate verification for every generated tls
+// outbound, whatever the URI says. Reality authenticates the server by its
+// public key instead of a certificate and is unaffected.
+var Insecure bool
+
+// OverrideSNI, when set, replaces the serverName of every generated tls and
+// reality outbound, whatever the URI says — for probing which SNI values get
+// through a network's SNI filtering.
+var OverrideSNI string
+
+// LogLevel is xray's log.loglevel. Anything other than "none" also makes Start
+// capture the process output, retrievable with Output.
+var LogLevel = "none"
+
+// LogLevels lists the values accepted for LogLevel.
+var LogLevels = []string{"none", "error", "warning", "info", "debug"}
+
+// maxLogBytes caps how much captured output is kept per process (the tail wins).
+const maxLogBytes = 16 << 10
+
 // GenerateConfig creates an xray JSON config for the given proxy
 func GenerateConfig(cfg parser.ProxyConfig, socksPort int) ([]byte, error) {
+	outbounds, err := buildOutbounds(cfg)
+	if err != nil {
+		return nil, err
+	}
+	in := inbound(socksPort)
+	in["tag"] = "socks-in"
+	return json.MarshalIndent(xrayConfig(outbounds, in), "", "  ")
+}
+
+// GenerateClientConfig is a config for using cfg day to day rather than for
+// a check: SOCKS and HTTP inbounds with traffic sniffing and warning-level
+// logging, ready for `xray run -c`.
+func GenerateClientConfig(cfg parser.ProxyConfig, socksPort, httpPort int) ([]byte, error) {
+	outbounds, err := buildOutbounds(cfg)
+	if err != nil {
+		return nil, err
+	}
+	sniffing := map[string]interface{}{
+		"enabled":      true,
+		"destOverride": []string{"http", "tls"},
+	}
+	socksIn := inbound(socksPort)
+	socksIn["tag"] = "socks-in"
+	socksIn["sniffing"] = sniffing
+	httpIn := map[string]interface{}{
+		"tag":      "http-in",
+		"listen":   ListenAddr,
+		"port":     httpPort,
+		"protocol": "http",
+		"sniffing": sniffing,
+	}
+	config := xrayConfig(outbounds, socksIn, httpIn)
+	config["log"] = map[string]interface{}{"loglevel": "warning"}
+	return json.MarshalIndent(config, "", "  ")
+}
+
+// GenerateDirectConfig is a config whose SOCKS inbound goes straight out
+// (freedom outbound). It exercises xray and the local SOCKS hop without any
+// remote server, which -doctor uses to test the environment.
+func GenerateDirectConfig(socksPort int) ([]byte, error) {
+	in := inbound(socksPort)
+	in["tag"] = "socks-in"
+	outbounds := []interface{}{map[string]interface{}{"tag": "proxy", "protocol": "freedom"}}
+	if len(DNSServers) > 0 {
+		outbounds = append(outbounds, map[string]interface{}{"tag": "direct", "protocol": "freedom"})
+	}
+	return json.MarshalIndent(xrayConfig(outbounds, in), "", "  ")
+}
+
+// GenerateTunConfig is GenerateConfig with a tun inbound named tunName in
+// place of SOCKS, so traffic sent through that interface takes the full
+// IP-level routing path. Creating the interface needs root on Linux.
+func GenerateTunConfig(cfg parser.ProxyConfig, tunName string) ([]byte, error) {
+	outbounds, err := buildOutbounds(cfg)
+	if err != nil {
+		return nil, err
+	}
+	in := map[string]interface{}{
+		"tag":      "tun-in",
+		"protocol": "tun",
+		"settings": map[string]interface{}{
+			"name": tunName,
+			"MTU":  1500,
+		},
+		"sniffing": map[string]interface{}{
+			"enabled":      true,
+			"destOverride": []string{"http", "tls"},
+		},
+	}
+	return json.MarshalIndent(xrayConfig(outbounds, in), "", "  ")
+}
+
+// buildOutbounds returns the tested outbound (tag "proxy") followed by the
+// helper outbounds the package options call for (front relay, direct for DNS).
+func buildOutbounds(cfg parser.ProxyConfig) ([]interface{}, error) {
+	ob, err := buildOutbound(cfg)
+	if err != nil {
+		return nil, err
+	}
+	ob["tag"] = "proxy"
+	if n := muxConcurrency(cfg); n > 0 {
+		ob["mux"] = map[string]interface{}{
+			"enabled":     true,
+			"concurrency": n,
+		}
+	}
+	outbounds := []interface{}{ob}
+
+	if Front != nil {
+		front, err := buildOutbound(Front)
+		if err != nil {
+			return nil, fmt.Errorf("front: %w", err)
+		}
+		front["tag"] = "front"
+		sockopt(ob)["dialerProxy"] = "front"
+		outbounds = append(outbounds, front)
+	}
+
+	if len(DNSServers) > 0 {
+		sockopt(ob)["domainStrategy"] = "UseIP"
+		outbounds = append(outbounds, map[string]interface{}{
+			"tag":      "direct",
+			"protocol": "freedom",
+		})
+	}
+	return outbounds, nil
+}
+
+// muxConcurrency resolves the effective mux setting for cfg: the URI's own mux
+// parameter wins over MuxConcurrency. Flow (xtls-rprx-vision) is incompatible with mux.
+func muxConcurrency(cfg parser.ProxyConfig) int {
+	n := MuxConcurrency
+	switch c := cfg.(type) {
+	case *parser.VlessConfig:
+		if c.Flow != "" {
+			return 0
+		}
+		if c.Mux != 0 {
+			n = c.Mux
+		}
+	case *parser.TrojanConfig:
+		if c.Mux != 0 {
+			n = c.Mux
+		}
+	}
+	return n
+}
+
+// sockopt returns the outbound's streamSettings.sockopt map, creating it if needed
+func sockopt(ob map[string]interface{}) map[string]interface{} {
+	ss, _ := ob["streamSettings"].(map[string]interface{})
+	if ss == nil {
+		ss = map[string]interface{}{}
+		ob["streamSettings"] = ss
+	}
+	so, _ := ss["sockopt"].(map[string]interface{})
+	if so == nil {
+		so = map[string]interface{}{}
+		ss["sockopt"] = so
+	}
+	return so
+}
+
+// buildOutbound dispatches to the per-protocol outbound builder
+func buildOutbound(cfg parser.ProxyConfig) (map[string]interface{}, error) {
 	switch c := cfg.(type) {
 	case *parser.VlessConfig:
-		return generateVlessConfig(c, socksPort)
+		return vlessOutbound(c), nil
 	case *parser.SSConfig:
-		return generateSSConfig(c, socksPort)
+		return ssOutbound(c), nil
 	case *parser.VmessConfig:
-		return generateVmessConfig(c, socksPort)
+		return vmessOutbound(c), nil
 	case *parser.TrojanConfig:
-		return generateTrojanConfig(c, socksPort)
+		if c.SSMethod != "" {
+			return nil, fmt.Errorf("trojan-go encryption ss;%s is not supported by xray (no shadowsocks layer inside trojan)", c.SSMethod)
+		}
+		return trojanOutbound(c), nil
+	case *parser.SocksConfig:
+		return plainProxyOutbound("socks", c.Server, c.Port, c.Username, c.Password, nil), nil
+	case *parser.HttpConfig:
+		var ss map[string]interface{}
+		if c.TLS {
+			tls := map[string]interface{}{"serverName": c.Server}
+			if OverrideSNI != "" {
+				tls["serverName"] = OverrideSNI
+			}
+			if Insecure {
+				tls["allowInsecure"] = true
+			}
+			ss = map[string]interface{}{"security": "tls", "tlsSettings": tls}
+		}
+		return plainProxyOutbound("http", c.Server, c.Port, c.Username, c.Password, ss), nil
 	default:
 		return nil, fmt.Errorf("unsupported config type: %T", cfg)
 	}
 }
 
 // inbound returns a standard SOCKS5 inbound block
-func inbound(socksPort int) interface{} {
+func inbound(socksPort int) map[string]interface{} {
 	return map[string]interface{}{
-		"listen":   "127.0.0.1",
+		"listen":   ListenAddr,
 		"port":     socksPort,
 		"protocol": "socks",
 		"settings": map[string]interface{}{
 			"auth": "noauth",
-			"udp":  false,
+			"udp":  true,
 		},
 	}
 }
 
+// streamParams are the transport/security fields shared by vless, vmess and trojan
+type streamParams struct {
+	Network    string
+	Security   string
+	SNI        string
+	Host       string
+	Path       string
+	Fp         string
+	HeaderType string // tcp header obfuscation ("http" or none), kcp/quic packet header (srtp, utp, wechat-video, ...)
+	PublicKey  string // reality pbk
+	ShortID    string // reality sid
+	SpiderX    string // reality spx
+
+	AllowInsecure bool // tls: skip certificate verification
+
+	Server string // server address, the serverName of last resort (see sniFallback)
+
+	Mode  string // xhttp mode: auto, packet-up, stream-up, stream-one
+	Extra string // xhttp extra JSON
+}
+
+// sniFallback is the serverName of a tls/reality config without sni, the
+// way common clients default it: the transport host, else the server address.
+// Servers that require SNI fail the handshake on an empty one.
+func sniFallback(host, server string) string {
+	if host != "" {
+		return host
+	}
+	return server
+}
+
+// ImpliedSNI returns the serverName GenerateConfig falls back to for a
+// tls/reality config whose URI has no sni, or "" when the URI sets one (or
+// the config has no TLS layer).
+func ImpliedSNI(cfg parser.ProxyConfig) string {
+	sni, host, server, ok := tlsNames(cfg)
+	if !ok || sni != "" || OverrideSNI != "" {
+		return ""
+	}
+	return sniFallback(host, server)
+}
+
+// ServerName returns the serverName GenerateConfig puts in cfg's tls/reality
+// settings, or "" when the config has no TLS layer of xray's.
+func ServerName(cfg parser.ProxyConfig) string {
+	sni, host, server, ok := tlsNames(cfg)
+	switch {
+	case !ok:
+		return ""
+	case OverrideSNI != "":
+		return OverrideSNI
+	case sni != "":
+		return sni
+	}
+	return sniFallback(host, server)
+}
+
+// tlsNames returns the names the serverName of cfg is derived from; ok is
+// false unless cfg is a vless, vmess or trojan config over tls or reality.
+func tlsNames(cfg parser.ProxyConfig) (sni, host, server string, ok bool) {
+	switch c := cfg.(type) {
+	case *parser.VlessConfig:
+		ok = c.Security == "tls" || c.Security == "reality"
+		return c.SNI, c.Host, c.Server, ok
+	case *parser.VmessConfig:
+		ok = c.TLS == "tls" || c.TLS == "reality"
+		return c.SNI, c.Host, c.Server, ok
+	case *parser.TrojanConfig:
+		ok = c.Security == "" || c.Security == "tls" || c.Security == "reality"
+		return c.SNI, c.Host, c.Server, ok
+	}
+	return "", "", "", false
+}
+
 // buildStreamSettings constructs streamSettings for transport-layer options
-func buildStreamSettings(network, security, sni, host, path, fp string) map[string]interface{} {
+func buildStreamSettings(p streamParams) map[string]interface{} {
+	network, security, sni, host, path, fp := p.Network, p.Security, p.SNI, p.Host, p.Path, p.Fp
+	if OverrideSNI != "" {
+		sni = OverrideSNI
+	} else if sni == "" && (security == "tls" || security == "reality") {
+		sni = sniFallback(host, p.Server)
+	}
+	if security == "" {
+		security = "none" // plaintext: no tlsSettings/realitySettings below
+	}
 	ss := map[string]interface{}{
 		"network":  network,
 		"security": security,
@@ -51,20 +340,42 @@ func buildStreamSettings(network, security, sni, host, path, fp string) map[stri
 		if fp != "" {
 			tls["fingerprint"] = fp
 		}
+		if p.AllowInsecure || Insecure {
+			tls["allowInsecure"] = true
+		}
 		ss["tlsSettings"] = tls
 	case "reality":
-		ss["realitySettings"] = map[string]interface{}{
+		if fp == "" {
+			fp = DefaultFingerprint
+		}
+		reality := map[string]interface{}{
 			"serverName":  sni,
 			"fingerprint": fp,
 		}
+		if p.PublicKey != "" {
+			reality["publicKey"] = p.PublicKey
+			reality["shortId"] = p.ShortID
+		}
+		if p.SpiderX != "" {
+			reality["spiderX"] = p.SpiderX
+		}
+		ss["realitySettings"] = reality
 	}
 
 	switch network {
+	case "tcp", "":
+		if p.HeaderType == "http" {
+			ss["tcpSettings"] = map[string]interface{}{
+				"header": httpHeaderObfs(host, path),
+			}
+		}
 	case "ws":
-		ss["wsSettings"] = map[string]interface{}{
-			"path":    path,
-			"headers": map[string]string{"Host": host},
+		ws := map[string]interface{}{"path": path}
+		if host != "" {
+			// an empty Host header would be sent as is; without one xray uses the address
+			ws["headers"] = map[string]string{"Host": host}
 		}
+		ss["wsSettings"] = ws
 	case "grpc":
 		ss["grpcSettings"] = map[string]interface{}{
 			"serviceName": path,
@@ -80,27 +391,96 @@ func buildStreamSettings(network, security, sni, host, path, fp string) map[stri
 			"host": host,
 		}
 	case "xhttp", "splithttp":
-		ss["xhttpSettings"] = map[string]interface{}{
+		xhttp := map[string]interface{}{
 			"path": path,
 			"host": host,
 		}
+		if p.Mode != "" {
+			xhttp["mode"] = p.Mode
+		}
+		// extra is an opaque JSON object passed through as-is; drop it if malformed
+		if p.Extra != "" && json.Valid([]byte(p.Extra)) {
+			xhttp["extra"] = json.RawMessage(p.Extra)
+		}
+		ss["xhttpSettings"] = xhttp
+	case "kcp", "mkcp":
+		// v2rayN convention: the kcp seed travels in path
+		ss["network"] = "kcp"
+		kcp := map[string]interface{}{"header": packetHeader(p.HeaderType)}
+		if path != "" {
+			kcp["seed"] = path
+		}
+		ss["kcpSettings"] = kcp
+	case "quic":
+		// v2rayN convention: quic security (none, aes-128-gcm, chacha20-poly1305) in host, key in path
+		quicSecurity := host
+		if quicSecurity == "" {
+			quicSecurity = "none"
+		}
+		ss["quicSettings"] = map[string]interface{}{
+			"security": quicSecurity,
+			"key":      path,
+			"header":   packetHeader(p.HeaderType),
+		}
 	}
 
 	return ss
 }
 
-func generateVlessConfig(c *parser.VlessConfig, socksPort int) ([]byte, error) {
-	ss := buildStreamSettings(c.Type, c.Security, c.SNI, c.Host, c.Path, c.Fp)
+// packetHeader builds the header block of kcp/quic settings; unset means none.
+func packetHeader(headerType string) map[string]interface{} {
+	if headerType == "" {
+		headerType = "none"
+	}
+	return map[string]interface{}{"type": headerType}
+}
+
+// httpHeaderObfs builds the tcpSettings.header block disguising traffic as
+// HTTP/1.1 requests. host and path may be comma-separated lists.
+func httpHeaderObfs(host, path string) map[string]interface{} {
+	paths := splitComma(path)
+	if len(paths) == 0 {
+		paths = []string{"/"}
+	}
+	request := map[string]interface{}{
+		"version": "1.1",
+		"method":  "GET",
+		"path":    paths,
+	}
+	if hosts := splitComma(host); len(hosts) > 0 {
+		request["headers"] = map[string]interface{}{"Host": hosts}
+	}
+	return map[string]interface{}{
+		"type":    "http",
+		"request": request,
+	}
+}
 
-	// Reality needs publicKey + shortId
-	if c.Security == "reality" && c.PublicKey != "" {
-		ss["realitySettings"] = map[string]interface{}{
-			"serverName":  c.SNI,
-			"fingerprint": c.Fp,
-			"publicKey":   c.PublicKey,
-			"shortId":     c.ShortID,
+func splitComma(s string) []string {
+	var out []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
 		}
 	}
+	return out
+}
+
+func vlessOutbound(c *parser.VlessConfig) map[string]interface{} {
+	ss := buildStreamSettings(streamParams{
+		Network:    c.Type,
+		Security:   c.Security,
+		SNI:        c.SNI,
+		Host:       c.Host,
+		Path:       c.Path,
+		Fp:         c.Fp,
+		HeaderType: c.HeaderType,
+		PublicKey:  c.PublicKey,
+		ShortID:    c.ShortID,
+		Mode:       c.Mode,
+		Extra:      c.Extra,
+		Server:     c.Server,
+	})
 
 	enc := c.Encryption
 	if enc == "" {
@@ -115,7 +495,7 @@ func generateVlessConfig(c *parser.VlessConfig, socksPort int) ([]byte, error) {
 		user["flow"] = c.Flow
 	}
 
-	config := xrayConfig(socksPort, "vless", map[string]interface{}{
+	return outbound("vless", map[string]interface{}{
 		"vnext": []interface{}{
 			map[string]interface{}{
 				"address": c.Server,
@@ -124,12 +504,10 @@ func generateVlessConfig(c *parser.VlessConfig, socksPort int) ([]byte, error) {
 			},
 		},
 	}, ss)
-
-	return json.MarshalIndent(config, "", "  ")
 }
 
-func generateSSConfig(c *parser.SSConfig, socksPort int) ([]byte, error) {
-	config := xrayConfig(socksPort, "shadowsocks", map[string]interface{}{
+func ssOutbound(c *parser.SSConfig) map[string]interface{} {
+	return outbound("shadowsocks", map[string]interface{}{
 		"servers": []interface{}{
 			map[string]interface{}{
 				"address":  c.Server,
@@ -139,23 +517,35 @@ func generateSSConfig(c *parser.SSConfig, socksPort int) ([]byte, error) {
 			},
 		},
 	}, nil)
-
-	return json.MarshalIndent(config, "", "  ")
 }
 
-func generateVmessConfig(c *parser.VmessConfig, socksPort int) ([]byte, error) {
+func vmessOutbound(c *parser.VmessConfig) map[string]interface{} {
 	security := c.Security
 	if security == "" {
 		security = "auto"
 	}
 
 	tlsSec := ""
-	if c.TLS == "tls" {
-		tlsSec = "tls"
+	if c.TLS == "tls" || c.TLS == "reality" {
+		tlsSec = c.TLS
 	}
-	ss := buildStreamSettings(c.Network, tlsSec, c.SNI, c.Host, c.Path, "")
+	ss := buildStreamSettings(streamParams{
+		Network:    c.Network,
+		Security:   tlsSec,
+		SNI:        c.SNI,
+		Host:       c.Host,
+		Path:       c.Path,
+		Fp:         c.Fp,
+		HeaderType: c.HeaderType,
+		PublicKey:  c.PublicKey,
+		ShortID:    c.ShortID,
+		SpiderX:    c.SpiderX,
+
+		AllowInsecure: c.AllowInsecure,
+		Server:        c.Server,
+	})
 
-	config := xrayConfig(socksPort, "vmess", map[string]interface{}{
+	return outbound("vmess", map[string]interface{}{
 		"vnext": []interface{}{
 			map[string]interface{}{
 				"address": c.Server,
@@ -163,25 +553,36 @@ func generateVmessConfig(c *parser.VmessConfig, socksPort int) ([]byte, error) {
 				"users": []interface{}{
 					map[string]interface{}{
 						"id":       c.UUID,
-						"alterId":  c.Aid,
+						"alterId":  0, // AEAD; xray dropped the legacy alterId > 0 protocol
 						"security": security,
 					},
 				},
 			},
 		},
 	}, ss)
-
-	return json.MarshalIndent(config, "", "  ")
 }
 
-func generateTrojanConfig(c *parser.TrojanConfig, socksPort int) ([]byte, error) {
+func trojanOutbound(c *parser.TrojanConfig) map[string]interface{} {
 	security := c.Security
 	if security == "" {
 		security = "tls"
 	}
-	ss := buildStreamSettings(c.Type, security, c.SNI, c.Host, c.Path, c.Fp)
+	ss := buildStreamSettings(streamParams{
+		Network:    c.Type,
+		Security:   security,
+		SNI:        c.SNI,
+		Host:       c.Host,
+		Path:       c.Path,
+		Fp:         c.Fp,
+		HeaderType: c.HeaderType,
+		PublicKey:  c.PublicKey,
+		ShortID:    c.ShortID,
+		Mode:       c.Mode,
+		Extra:      c.Extra,
+		Server:     c.Server,
+	})
 
-	config := xrayConfig(socksPort, "trojan", map[string]interface{}{
+	return outbound("trojan", map[string]interface{}{
 		"servers": []interface{}{
 			map[string]interface{}{
 				"address":  c.Server,
@@ -190,27 +591,77 @@ func generateTrojanConfig(c *parser.TrojanConfig, socksPort int) ([]byte, error)
 			},
 		},
 	}, ss)
+}
 
-	return json.MarshalIndent(config, "", "  ")
+// plainProxyOutbound builds a socks or http outbound. These are only needed
+// when a plain proxy is used as the -front hop; direct checks bypass xray.
+func plainProxyOutbound(protocol, server string, port int, username, password string, streamSettings map[string]interface{}) map[string]interface{} {
+	srv := map[string]interface{}{
+		"address": server,
+		"port":    port,
+	}
+	if username != "" || password != "" {
+		srv["users"] = []interface{}{
+			map[string]interface{}{"user": username, "pass": password},
+		}
+	}
+	return outbound(protocol, map[string]interface{}{
+		"servers": []interface{}{srv},
+	}, streamSettings)
 }
 
-// xrayConfig assembles the full xray JSON config document
-func xrayConfig(socksPort int, protocol string, settings map[string]interface{}, streamSettings map[string]interface{}) map[string]interface{} {
-	outbound := map[string]interface{}{
+// outbound assembles a single outbound object
+func outbound(protocol string, settings map[string]interface{}, streamSettings map[string]interface{}) map[string]interface{} {
+	ob := map[string]interface{}{
 		"protocol": protocol,
 		"settings": settings,
 	}
 	if streamSettings != nil {
-		outbound["streamSettings"] = streamSettings
+		ob["streamSettings"] = streamSettings
 	}
+	return ob
+}
 
-	return map[string]interface{}{
+// xrayConfig assembles the full xray JSON config document around tagged
+// inbounds. The first outbound is the one the inbounds are routed to.
+func xrayConfig(outbounds []interface{}, ins ...map[string]interface{}) map[string]interface{} {
+	inbounds := make([]interface{}, len(ins))
+	tags := make([]string, len(ins))
+	for i, in := range ins {
+		inbounds[i] = in
+		tags[i] = in["tag"].(string)
+	}
+	rules := []interface{}{
+		map[string]interface{}{
+			"type":        "field",
+			"inboundTag":  tags,
+			"outboundTag": "proxy",
+		},
+	}
+
+	config := map[string]interface{}{
 		"log": map[string]interface{}{
-			"loglevel": "none",
+			"loglevel": LogLevel,
 		},
-		"inbounds":  []interface{}{inbound(socksPort)},
-		"outbounds": []interface{}{outbound},
+		"inbounds":  inbounds,
+		"outbounds": outbounds,
 	}
+
+	if len(DNSServers) > 0 {
+		config["dns"] = map[string]interface{}{
+			"servers": DNSServers,
+			"tag":     "dns-internal",
+		}
+		// Resolver queries for the server hostname go straight out, not via the system resolver.
+		rules = append(rules, map[string]interface{}{
+			"type":        "field",
+			"inboundTag":  []string{"dns-internal"},
+			"outboundTag": "direct",
+		})
+	}
+
+	config["routing"] = map[string]interface{}{"rules": rules}
+	return config
 }
 
 // Start launches xray with config provided via stdin, returns the running Cmd
@@ -219,6 +670,11 @@ func Start(configJSON []byte) (*exec.Cmd, error) {
 	cmd.Stdin = &bytesReader{data: configJSON}
 	cmd.Stdout = nil
 	cmd.Stderr = nil
+	if LogLevel != "none" {
+		buf := &logBuffer{}
+		cmd.Stdout = buf
+		cmd.Stderr = buf
+	}
 
 	if err := cmd.Start(); err != nil {
 		return nil, fmt.Errorf("xray start failed: %w", err)
@@ -226,6 +682,39 @@ func Start(configJSON []byte) (*exec.Cmd, error) {
 	return cmd, nil
 }
 
+// Available reports whether the xray binary is on PATH and runs, returning
+// the first line of `xray version`.
+func Available() (string, error) {
+	out, err := exec.Command("xray", "version").Output()
+	if err != nil {
+		return "", err
+	}
+	line, _, _ := strings.Cut(strings.TrimSpace(string(out)), "\n")
+	return line, nil
+}
+
+// Validate runs xray's config test mode (run -test) on configJSON and returns
+// xray's complaint when it rejects the config.
+func Validate(configJSON []byte) error {
+	cmd := exec.Command("xray", "run", "-test", "-config", "stdin:")
+	cmd.Stdin = &bytesReader{data: configJSON}
+	out, err := cmd.CombinedOutput()
+	if err == nil {
+		return nil
+	}
+	if _, ok := err.(*exec.ExitError); !ok {
+		return fmt.Errorf("xray -test failed: %w", err)
+	}
+	return fmt.Errorf("%s", lastLine(string(out)))
+}
+
+// lastLine returns the last non-empty line of s; xray prints the reason for a
+// rejected config last.
+func lastLine(s string) string {
+	lines := strings.Split(strings.TrimSpace(s), "\n")
+	return strings.TrimSpace(lines[len(lines)-1])
+}
+
 // Stop kills the xray process
 func Stop(cmd *exec.Cmd) {
 	if cmd == nil || cmd.Process == nil {
@@ -235,6 +724,40 @@ func Stop(cmd *exec.Cmd) {
 	_ = cmd.Wait()
 }
 
+// Output returns what the xray process has printed so far. It is empty unless
+// LogLevel was above "none" when the process was started.
+func Output(cmd *exec.Cmd) string {
+	if cmd == nil {
+		return ""
+	}
+	if buf, ok := cmd.Stderr.(*logBuffer); ok {
+		return buf.String()
+	}
+	return ""
+}
+
+// logBuffer collects process output, keeping only the last maxLogBytes.
+type logBuffer struct {
+	mu   sync.Mutex
+	data []byte
+}
+
+func (b *logBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.data = append(b.data, p...)
+	if over := len(b.data) - maxLogBytes; over > 0 {
+		b.data = append(b.data[:0], b.data[over:]...)
+	}
+	return len(p), nil
+}
+
+func (b *logBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return string(b.data)
+}
+
 type bytesReader struct {
 	data []byte
 	pos  int